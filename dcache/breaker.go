@@ -0,0 +1,118 @@
+package dcache
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 熔断器：远程节点持续失败时，每个请求仍然会去访问它并等待超时。每个 httpGetter 拥有一个熔断器，
+// 连续失败 failures 次后熔断器打开(open)，cooldown 时间内的请求直接返回 ErrCircuitOpen，Group 随即回退到本地获取；
+// cooldown 之后进入半开(half-open)状态，只放行一个探测请求，成功则关闭熔断器，失败则再次打开。
+// 与健康检查不同，熔断器不会修改哈希环，key 与节点的映射保持不变。
+
+// ErrCircuitOpen is returned when a request to a peer is rejected by its open circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// SetCircuitBreaker opens the circuit to a peer after failures consecutive failed requests, for cooldown.
+// 请求返回网络错误或 5xx 时视为失败，请求被调用方取消不计入。failures <= 0 表示关闭熔断器，默认关闭
+func (p *HTTPPool) SetCircuitBreaker(failures int, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakerFailures, p.breakerCooldown = failures, cooldown
+	for _, getter := range p.httpGetters {
+		getter.breaker.configure(failures, cooldown)
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breaker struct {
+	mu          sync.Mutex
+	failures    int // 打开熔断器所需的连续失败次数，<= 0 表示不熔断
+	cooldown    time.Duration
+	state       breakerState
+	consecutive int       // 连续失败的次数
+	openedAt    time.Time // 熔断器打开的时间
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{failures: failures, cooldown: cooldown}
+}
+
+// configure 修改熔断器的阈值，并将熔断器重置为关闭状态
+func (b *breaker) configure(failures int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.cooldown = failures, cooldown
+	b.state, b.consecutive = breakerClosed, 0
+}
+
+// allow 判断是否放行请求。半开状态下只放行一个探测请求，探测结束之前的其他请求同样被拒绝
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures <= 0 {
+		return nil
+	}
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record 记录请求的结果，cancelled 为 true 表示请求被调用方取消，不影响熔断器的状态
+func (b *breaker) record(failed, cancelled bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures <= 0 {
+		return
+	}
+	if cancelled {
+		if b.state == breakerHalfOpen {
+			// 探测请求被取消，允许下一个请求继续探测
+			b.state = breakerOpen
+			b.openedAt = time.Now().Add(-b.cooldown)
+		}
+		return
+	}
+	if !failed {
+		b.state, b.consecutive = breakerClosed, 0
+		return
+	}
+	b.consecutive++
+	if b.state == breakerHalfOpen || b.consecutive >= b.failures {
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+}
+
+// do 经过熔断器发送请求，并通过请求头传递 ctx 的剩余时间，网络错误与 5xx 响应视为失败
+func (h *httpGetter) do(req *http.Request) (*http.Response, error) {
+	if err := h.breaker.allow(); err != nil {
+		return nil, err
+	}
+	setTimeoutHeader(req)
+	res, err := h.client.Do(req)
+	h.breaker.record(err != nil || res.StatusCode >= http.StatusInternalServerError, req.Context().Err() != nil)
+	return res, err
+}
@@ -1,10 +1,29 @@
 package dcache
 
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
 // 定义一个只读的数据结构byteview用来表示缓存值，即存储在缓存中的数据类型。
 
 // Byteview holds an immutable view of bytes.
 type ByteView struct {
-	b []byte // b 将会存储真实的缓存值。选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	b          []byte        // b 将会存储真实的缓存值。选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	compressed bool          // b 是否为 gzip 压缩后的数据，只在 Group 内部使用
+	err        error         // 负缓存的墓碑标记，不为 nil 时表示缓存的是回调函数返回的错误，与值为空的缓存值区分开，只在 Group 内部使用
+	softExpire time.Time     // 软过期时间，超过后读取会触发后台刷新，零值表示不刷新，只在 Group 内部使用
+	version    int64         // 写入时间戳，较旧的版本不会覆盖缓存中较新的版本，只在 Group 内部使用
+	ttl        time.Duration // GetterWithTTL 返回的过期时间，0 表示使用 Group 默认的过期策略，只在 Group 内部使用
+	expire     time.Time     // 开启 serveStaleOnError 时由 Group 判断的过期时间，零值表示不过期，只在 Group 内部使用
+	stale      bool          // 回调函数返回错误时代替错误返回的过期值
+	deadline   time.Time     // 记录在本节点缓存中的过期时间，零值表示永不过期，用于计算剩余的过期时间，只在 Group 内部使用
+}
+
+// Stale reports whether v is an expired value served because the getter failed to refresh it, see SetServeStaleOnError.
+func (v ByteView) Stale() bool {
+	return v.stale
 }
 
 // 实现Value接口
@@ -18,11 +37,30 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// Bytes returns the internal slice of the data without copying, for read-only use.
+// 返回的切片与缓存共享同一块内存，调用方不能修改它，否则缓存中的值（以及其他调用方读到的值）会被一并修改；
+// 需要修改时使用 ByteSlice。适合直接写入响应等只读的场景，省去一次拷贝
+func (v ByteView) Bytes() []byte {
+	return v.b
+}
+
+// Reader returns an io.Reader over the data without copying.
+func (v ByteView) Reader() io.Reader {
+	return bytes.NewReader(v.b)
+}
+
 // String returns the data as a string, making a copy if necessary.
 func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// WriteTo writes the data to w, implements io.WriterTo.
+// 与 w.Write(v.ByteSlice()) 相比，WriteTo 不会拷贝数据，适合将缓存值直接写入 HTTP 响应等场景
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(v.b)
+	return int64(n), err
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
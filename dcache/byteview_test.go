@@ -0,0 +1,93 @@
+package dcache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	v := ByteView{b: []byte("630")}
+	var buf bytes.Buffer
+	if n, err := v.WriteTo(&buf); err != nil || n != 3 || buf.String() != "630" {
+		t.Fatalf("WriteTo failed, wrote %d bytes %q: %v", n, buf.String(), err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	v := ByteView{b: []byte("630")}
+	b, err := io.ReadAll(v.Reader())
+	if err != nil || string(b) != "630" {
+		t.Fatalf("Reader returned %q: %v", b, err)
+	}
+}
+
+// TestBytesAliasing 说明 Bytes 返回的切片与缓存共享内存，修改它属于误用，后果由调用方承担
+func TestBytesAliasing(t *testing.T) {
+	g := NewGroup("bytes-aliasing", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	view, _ := g.Get("Tom")
+	view.ByteSlice()[0] = 'x'
+	if cached, _ := g.Get("Tom"); cached.String() != "630" {
+		t.Fatalf("modifying ByteSlice should not affect the cache, but got %q", cached.String())
+	}
+	view.Bytes()[0] = 'x'
+	if cached, _ := g.Get("Tom"); cached.String() != "x30" {
+		t.Fatalf("Bytes should return the internal slice, but got %q", cached.String())
+	}
+}
+
+func ExampleByteView_Bytes() {
+	g := NewGroup("example-bytes", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	view, _ := g.Get("Tom")
+	// 只读的场景（如写入响应）直接使用内部的切片，不会拷贝
+	os.Stdout.Write(view.Bytes())
+	fmt.Println()
+	// 需要修改时使用 ByteSlice 获取副本，修改副本不会影响缓存
+	b := view.ByteSlice()
+	b[0] = 'V'
+	fmt.Println(string(b))
+	// Output:
+	// value of Tom
+	// Value of Tom
+}
+
+// 对比写出缓存值时 ByteSlice 与 WriteTo 的内存分配，WriteTo 不会拷贝数据：
+//
+//	go test -bench='Write|Reader' -benchmem ./dcache
+func BenchmarkWriteByteSlice(b *testing.B) {
+	v := ByteView{b: make([]byte, 4<<10)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.Discard.Write(v.ByteSlice())
+	}
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	v := ByteView{b: make([]byte, 4<<10)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = v.WriteTo(io.Discard)
+	}
+}
+
+func BenchmarkWriteBytes(b *testing.B) {
+	v := ByteView{b: make([]byte, 4<<10)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.Discard.Write(v.Bytes())
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	v := ByteView{b: make([]byte, 4<<10)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.Copy(io.Discard, v.Reader())
+	}
+}
@@ -5,34 +5,354 @@ package dcache
 import (
 	"DCache/dcache/lru"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Policy is the eviction policy of cache, lru.Cache and lfu.Cache both implement it.
+// Policy 抽象了缓存的淘汰策略，cache 只依赖于该接口，从而可以在 LRU、LFU 等策略之间切换。
+type Policy interface {
+	Add(key string, value lru.Value)
+	AddWithTTL(key string, value lru.Value, ttl time.Duration)
+	Get(key string) (value lru.Value, ok bool)
+	Peek(key string) (value lru.Value, ok bool)
+	Remove(key string)
+	RemoveOldest()
+	Len() int
+	Bytes() int64
+	Keys() []string
+	Clear()
+}
+
+// PolicyFactory creates a Policy which can use at most maxBytes memory.
+type PolicyFactory func(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy
+
+// LRUPolicy is the default PolicyFactory.
+func LRUPolicy(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy {
+	return lru.New(maxBytes, 0, onEvicted)
+}
+
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
+	mu         sync.RWMutex
+	policy     Policy
+	newPolicy  PolicyFactory // 为 nil 时使用 LRUPolicy
 	cacheBytes int64
+	// shards 不为空时，key 按照哈希值分散到各个分片中，每个分片拥有独立的锁，cache 自身的 policy 不再使用
+	shards []*cache
+	// onEvicted 在记录被移除时调用，为 nil 时不回调。
+	// 持有 c.mu 期间被移除的记录先放入 evicted，释放锁之后再回调，回调中可以再次访问缓存而不会死锁
+	onEvicted func(key string, value ByteView, reason lru.EvictReason)
+	evicted   []lru.Entry
+	// onAdd, onRemove 在持有 c.mu 时对 add 写入的记录以及被移除的记录调用，调用顺序与缓存的修改顺序一致，
+	// 因此只能执行不会阻塞、不会访问缓存的操作。持久化通过它们按顺序记录写入与删除
+	onAdd     func(key string, value ByteView)
+	onRemove  func(key string, reason lru.EvictReason)
+	evictions atomic.Int64 // 因容量不足被淘汰的记录数
+	// promotions 记录共享读锁下命中的 key，持有写锁时再应用到 policy 上，为 nil 时命中同样持有写锁
+	promotions *promotionBuffer
+}
+
+// newShards 创建 n 个分片，cacheBytes 平均分配给各个分片
+func newShards(cacheBytes int64, n int, newPolicy PolicyFactory) []*cache {
+	shards := make([]*cache, n)
+	for i := range shards {
+		shards[i] = &cache{cacheBytes: cacheBytes / int64(n), newPolicy: newPolicy}
+	}
+	return shards
+}
+
+// shard 返回 key 所在的分片
+func (c *cache) shard(key string) *cache {
+	return c.shards[fnv32(key)%uint32(len(c.shards))]
+}
+
+// fnv32 返回 key 的 FNV-1a 哈希值，直接遍历字符串以避免内存分配
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
 }
 
-// 在 add 方法中，判断了 c.lru 是否为 nil，如果等于 nil 再创建实例。
+// 在 add 方法中，判断了 c.policy 是否为 nil，如果等于 nil 再创建实例。
 // 这种方法称之为延迟初始化(Lazy Initialization)，一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。
 // 主要用于提高性能，并减少程序内存要求。
-func (c *cache) add(key string, value ByteView) {
+// 已缓存的记录版本更新时，add 会拒绝写入，返回 false，避免较旧的数据覆盖较新的数据
+func (c *cache) add(key string, value ByteView) bool {
+	if c.shards != nil {
+		return c.shard(key).add(key, value)
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	defer c.unlock()
+	c.lazyInit()
+	c.applyPromotions()
+	if c.stale(key, value) {
+		return false
+	}
+	c.policy.Add(key, value)
+	if c.onAdd != nil {
+		c.onAdd(key, value)
+	}
+	return true
+}
+
+// addWithTTL 与 add 相同，但记录在 ttl 后过期
+func (c *cache) addWithTTL(key string, value ByteView, ttl time.Duration) bool {
+	if c.shards != nil {
+		return c.shard(key).addWithTTL(key, value, ttl)
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	c.lazyInit()
+	c.applyPromotions()
+	if c.stale(key, value) {
+		return false
+	}
+	c.policy.AddWithTTL(key, value, ttl)
+	return true
+}
+
+// stale 判断 value 是否比已缓存的记录更旧，需要在持有 c.mu 时调用
+func (c *cache) stale(key string, value ByteView) bool {
+	if v, ok := c.policy.Peek(key); ok {
+		return value.version < v.(ByteView).version
 	}
-	c.lru.Add(key, value)
+	return false
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	if c.shards != nil {
+		return c.shard(key).get(key)
+	}
+	if c.promotions != nil {
+		if v, ok := c.getShared(key); ok {
+			return v, true
+		}
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	defer c.unlock()
+	c.lazyInit()
+	c.applyPromotions()
+	if v, ok := c.policy.Get(key); ok {
+		return v.(ByteView), ok
+	}
+	return
+}
+
+// peek 与 get 相同，但不会更新 key 的访问记录
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	if c.shards != nil {
+		return c.shard(key).peek(key)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.policy == nil {
+		return
 	}
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.policy.Peek(key); ok {
 		return v.(ByteView), ok
 	}
 	return
 }
+
+func (c *cache) remove(key string) {
+	if c.shards != nil {
+		c.shard(key).remove(key)
+		return
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return
+	}
+	c.policy.Remove(key)
+}
+
+// touch 在持有锁的情况下将 key 的值交给 extend，再以 extend 返回的值与过期时间重新写入，ttl <= 0 表示永不过期。
+// key 不存在或者 extend 返回 false 时不写入，返回 false
+func (c *cache) touch(key string, extend func(value ByteView) (ByteView, time.Duration, bool)) bool {
+	if c.shards != nil {
+		return c.shard(key).touch(key, extend)
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return false
+	}
+	v, ok := c.policy.Peek(key)
+	if !ok {
+		return false
+	}
+	value, ttl, ok := extend(v.(ByteView))
+	if !ok {
+		return false
+	}
+	c.policy.AddWithTTL(key, value, ttl)
+	return true
+}
+
+// keys 在持有锁的情况下获取所有 key 的快照，可以与 add/get 并发调用
+// 分片时依次返回各个分片的 key，只在分片内部保证顺序
+func (c *cache) keys() []string {
+	if c.shards != nil {
+		var keys []string
+		for _, shard := range c.shards {
+			keys = append(keys, shard.keys()...)
+		}
+		return keys
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return nil
+	}
+	return c.policy.Keys()
+}
+
+// rangeEntries 在持有读锁的情况下按照从旧到新的顺序对每条记录调用 fn，fn 返回 false 时停止，返回是否遍历完所有记录。
+// 通过 Peek 读取记录，不会更新访问记录；分片时依次遍历各个分片，只在分片内部保证顺序
+func (c *cache) rangeEntries(fn func(key string, value ByteView) bool) bool {
+	if c.shards != nil {
+		for _, shard := range c.shards {
+			if !shard.rangeEntries(fn) {
+				return false
+			}
+		}
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.policy == nil {
+		return true
+	}
+	for _, key := range c.policy.Keys() {
+		v, ok := c.policy.Peek(key)
+		if !ok {
+			continue
+		}
+		if !fn(key, v.(ByteView)) {
+			return false
+		}
+	}
+	return true
+}
+
+// len 返回缓存的记录条数
+func (c *cache) len() int {
+	if c.shards != nil {
+		n := 0
+		for _, shard := range c.shards {
+			n += shard.len()
+		}
+		return n
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.Len()
+}
+
+// bytes 返回缓存当前使用的内存字节数
+func (c *cache) bytes() int64 {
+	if c.shards != nil {
+		var n int64
+		for _, shard := range c.shards {
+			n += shard.bytes()
+		}
+		return n
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.Bytes()
+}
+
+func (c *cache) clear() {
+	if c.shards != nil {
+		for _, shard := range c.shards {
+			shard.clear()
+		}
+		return
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return
+	}
+	c.policy.Clear()
+}
+
+// evictionCount 返回因容量不足被淘汰的记录数，分片时为各个分片之和
+func (c *cache) evictionCount() int64 {
+	n := c.evictions.Load()
+	for _, shard := range c.shards {
+		n += shard.evictionCount()
+	}
+	return n
+}
+
+// maxEntryBytes 返回单条记录最多能占用的内存字节数，即单个分片的容量，0 表示不限制
+func (c *cache) maxEntryBytes() int64 {
+	if c.shards != nil {
+		return c.shards[0].cacheBytes
+	}
+	return c.cacheBytes
+}
+
+// lazyInit 需要在持有 c.mu 时调用
+func (c *cache) lazyInit() {
+	if c.policy != nil {
+		return
+	}
+	newPolicy := c.newPolicy
+	if newPolicy == nil {
+		newPolicy = LRUPolicy
+	}
+	c.policy = newPolicy(c.cacheBytes, func(key string, value lru.Value, reason lru.EvictReason) {
+		if reason == lru.EvictCapacity {
+			c.evictions.Add(1)
+		}
+		if c.onRemove != nil {
+			c.onRemove(key, reason)
+		}
+		if c.onEvicted != nil {
+			c.evicted = append(c.evicted, lru.Entry{Key: key, Value: value, Reason: reason})
+		}
+	})
+}
+
+// unlock 释放 c.mu，再对持有锁期间被移除的记录依次调用 onEvicted
+func (c *cache) unlock() {
+	evicted, onEvicted := c.evicted, c.onEvicted
+	c.evicted = nil
+	c.mu.Unlock()
+	for _, e := range evicted {
+		onEvicted(e.Key, e.Value.(ByteView), e.Reason)
+	}
+}
+
+// setOnEvicted 设置记录被移除时的回调函数，分片时设置到每个分片上
+func (c *cache) setOnEvicted(fn func(key string, value ByteView, reason lru.EvictReason)) {
+	for _, shard := range c.shards {
+		shard.setOnEvicted(fn)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvicted = fn
+}
+
+// setJournal 设置 onAdd 与 onRemove，分片时设置到每个分片上
+func (c *cache) setJournal(onAdd func(key string, value ByteView), onRemove func(key string, reason lru.EvictReason)) {
+	for _, shard := range c.shards {
+		shard.setJournal(onAdd, onRemove)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onAdd, c.onRemove = onAdd, onRemove
+}
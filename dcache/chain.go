@@ -0,0 +1,44 @@
+package dcache
+
+import (
+	"context"
+	"errors"
+)
+
+// ChainGetters returns a Getter which tries gs in order, until one of them returns the value.
+// 例如先访问较快的 Redis，未命中时再访问较慢的 SQL 数据库，最终的结果只写入一次缓存。
+// 如果所有 Getter 都返回 ErrNotFound，返回的错误同样满足 errors.Is(err, ErrNotFound)；
+// 如果有 Getter 返回了其他错误（如数据源故障），返回的错误只包含这些错误，避免将故障误判为 key 不存在。
+// 实现了 GetterContext 的 Getter 会收到调用方的 ctx。
+func ChainGetters(gs ...Getter) GetterContextFunc {
+	return func(ctx context.Context, key string) ([]byte, error) {
+		var missed, failed []error
+		for _, g := range gs {
+			var bytes []byte
+			var err error
+			if getter, ok := g.(GetterContext); ok {
+				bytes, err = getter.GetContext(ctx, key)
+			} else {
+				bytes, err = g.Get(key)
+			}
+			if err == nil {
+				return bytes, nil
+			}
+			if errors.Is(err, ErrNotFound) {
+				missed = append(missed, err)
+			} else {
+				failed = append(failed, err)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(failed) > 0 {
+			return nil, errors.Join(failed...)
+		}
+		if len(missed) > 0 {
+			return nil, errors.Join(missed...)
+		}
+		return nil, notFoundError(key)
+	}
+}
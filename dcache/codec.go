@@ -0,0 +1,133 @@
+package dcache
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// 节点间 HTTP 请求与响应 body 的序列化方式。
+// 客户端通过 Content-Type 声明请求 body 的编码，通过 Accept 声明期望的响应编码；
+// 服务端支持 protobuf 以及通过 SetCodec 设置的编码，不支持时分别返回 415 和 406，响应的 Content-Type 为实际使用的编码。
+// 未携带这两个请求头的旧版本客户端按照 protobuf 处理
+
+// Codec marshals and unmarshals the messages (pb.Request, pb.Response, pb.MultiRequest, pb.MultiResponse)
+// exchanged between peers.
+type Codec interface {
+	// ContentType 为该编码对应的 MIME 类型，用于协商双方使用的编码
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// legacyContentType 为旧版本使用的 Content-Type，视为 protobuf
+const legacyContentType = "application/octet-stream"
+
+// ProtobufCodec is the default Codec, which encodes the messages with protobuf.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// SetCodec sets the codec used to talk to remote peers, nil restores the default ProtobufCodec.
+// 服务端除 protobuf 外同样接受该编码，因此集群可以逐个节点地切换编码
+func (p *HTTPPool) SetCodec(codec Codec) {
+	if codec == nil {
+		codec = ProtobufCodec{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codec = codec
+	p.refreshGettersLocked()
+}
+
+// lookupCodec 返回服务端支持的、MIME 类型为 mediaType 的编码，mediaType 为空时使用 protobuf
+func (p *HTTPPool) lookupCodec(mediaType string) (Codec, bool) {
+	switch mediaType {
+	case "", "*/*", legacyContentType, ProtobufCodec{}.ContentType():
+		return ProtobufCodec{}, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.codec != nil && p.codec.ContentType() == mediaType {
+		return p.codec, true
+	}
+	return nil, false
+}
+
+// requestCodec 按照请求的 Content-Type 选择解码请求 body 的编码
+func (p *HTTPPool) requestCodec(r *http.Request) (Codec, bool) {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return p.lookupCodec("")
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, false
+	}
+	return p.lookupCodec(mediaType)
+}
+
+// responseCodec 按照请求的 Accept 选择编码响应 body 的编码，Accept 中有多个类型时选择第一个支持的
+func (p *HTTPPool) responseCodec(r *http.Request) (Codec, bool) {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return p.lookupCodec("")
+	}
+	for _, accept := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if codec, ok := p.lookupCodec(mediaType); ok {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// getCodec 返回客户端使用的编码，未设置时使用 protobuf
+func (h *httpGetter) getCodec() Codec {
+	if h.codec == nil {
+		return ProtobufCodec{}
+	}
+	return h.codec
+}
+
+// decodeResponse 检查响应的 Content-Type 与客户端使用的编码一致后解码 body
+func (h *httpGetter) decodeResponse(res *http.Response, body []byte, v interface{}) error {
+	codec := h.getCodec()
+	if header := res.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return fmt.Errorf("parsing response content type: %v", err)
+		}
+		legacy := mediaType == legacyContentType && codec.ContentType() == ProtobufCodec{}.ContentType()
+		if mediaType != codec.ContentType() && !legacy {
+			return fmt.Errorf("unexpected response content type %q, want %q", mediaType, codec.ContentType())
+		}
+	}
+	if err := codec.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding reponse body: %v", err)
+	}
+	return nil
+}
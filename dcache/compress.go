@@ -0,0 +1,62 @@
+package dcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// 缓存值压缩：超过阈值的缓存值在写入 mainCache 前使用 gzip 压缩，节省内存，并以压缩后的形式在节点间传输，
+// 读取时再透明地解压。压缩后的 ByteView 只在 Group 内部流转，返回给调用方的始终是解压后的数据。
+
+// SetCompression compresses values whose size is at least minBytes, 0 disables compression.
+func (g *Group) SetCompression(minBytes int) {
+	g.compressMin = minBytes
+}
+
+// compress 返回压缩后的 ByteView
+func (v ByteView) compress() (ByteView, error) {
+	if v.compressed {
+		return v, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(v.b); err != nil {
+		return ByteView{}, err
+	}
+	if err := w.Close(); err != nil {
+		return ByteView{}, err
+	}
+	v.b, v.compressed = buf.Bytes(), true
+	return v, nil
+}
+
+// decompress 返回解压后的 ByteView，未压缩的 ByteView 原样返回
+func (v ByteView) decompress() (ByteView, error) {
+	if !v.compressed {
+		return v, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(v.b))
+	if err != nil {
+		return ByteView{}, fmt.Errorf("decompressing value: %v", err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("decompressing value: %v", err)
+	}
+	v.b, v.compressed = b, false
+	return v, nil
+}
+
+// maybeCompress 在开启压缩且 value 达到阈值时返回压缩后的 ByteView，压缩失败时保留原始数据
+func (g *Group) maybeCompress(value ByteView) ByteView {
+	if g.compressMin <= 0 || value.compressed || value.Len() < g.compressMin {
+		return value
+	}
+	if compressed, err := value.compress(); err == nil {
+		return compressed
+	}
+	return value
+}
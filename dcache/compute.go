@@ -0,0 +1,44 @@
+package dcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// GetOrCompute returns the value cached for key, or calls compute to produce it and stores it in the cache.
+// 与 Get 相同先查找本节点的缓存，未命中（包括负缓存）时调用 compute 代替 Group 的回调函数。
+// 并发的调用方由 singleflight 去重，同一个 key 同时只会执行一次 compute；compute 返回错误时不写入缓存。
+// compute 无法发送给远程节点，因此只作用于本节点，即使 key 归属于远程节点也在本节点计算并缓存
+func (g *Group) GetOrCompute(key string, compute func() ([]byte, error)) (ByteView, error) {
+	if err := g.checkKey(key); err != nil {
+		return ByteView{}, err
+	}
+	if v, ok := g.lookupCache(key); ok && v.err == nil {
+		atomic.AddInt64(&g.stats.LocalHits, 1)
+		return v.decompress()
+	}
+	atomic.AddInt64(&g.stats.Misses, 1)
+	value, err := g.sf.DoCommit(context.Background(), computeFlightKey(key), func() (interface{}, error) {
+		// 与 getLocally 相同，版本取计算开始的时间
+		version := newVersion()
+		bytes, err := compute()
+		if err != nil {
+			return nil, err
+		}
+		return ByteView{b: cloneBytes(bytes), version: version}, nil
+	}, func(value interface{}) {
+		if err := g.populateCache(key, value.(ByteView)); err != nil {
+			g.logger.Printf("[dcache] Failed to cache %s: %v", key, err)
+		}
+	})
+	if err != nil {
+		atomic.AddInt64(&g.stats.Errors, 1)
+		return ByteView{}, err
+	}
+	return value.(ByteView), nil
+}
+
+// computeFlightKey 与回调函数的加载使用不同的 singleflight key，正在进行的 Get 不会把回调函数的结果返回给 GetOrCompute
+func computeFlightKey(key string) string {
+	return "compute:" + key
+}
@@ -4,19 +4,24 @@ import (
 	"hash/crc32"
 	"sort"
 	"strconv"
+	"sync"
 )
 
 // 一致性哈希
 
 type Hash func(data []byte) uint32
 
+// Map 可以被多个 goroutine 并发使用：Get、GetN、Nodes 持有读锁，Add、Remove 持有写锁，
+// 因此节点变化期间的查询总是看到一个完整的哈希环
 type Map struct {
+	mu       sync.RWMutex
 	replicas int // 虚拟节点的倍数
 	// 哈希环, sorted。我们将所有节点（真实节点+虚拟节点）的hash值都存储在keys中并排序。某个key对应的hash来了后，比新hash
 	// 小的第一个hash对应的节点即为这个key对应的节点
 	keys    []int
-	hash    Hash           // 允许自定义的hash函数
-	hashMap map[int]string // 虚拟节点hash值到真实节点的映射
+	hash    Hash                    // 允许自定义的hash函数
+	hashMap map[int]string          // 虚拟节点hash值到真实节点的映射
+	keyFunc func(key string) string // 计算 key 的hash值之前，先从 key 中提取用于hash的部分
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -34,6 +39,8 @@ func New(replicas int, fn Hash) *Map {
 // Add adds some keys to the hash
 // Add 接收若干个真实节点的名称，然后将真实节点和虚拟节点都加入到hash环
 func (m *Map) Add(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, key := range keys {
 		for i := 0; i < m.replicas; i++ {
 			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
@@ -44,12 +51,75 @@ func (m *Map) Add(keys ...string) {
 	sort.Ints(m.keys)
 }
 
+// Remove removes some keys from the hash
+// Remove 将真实节点及其对应的虚拟节点从hash环中移除，移除不存在的节点是一个空操作
+func (m *Map) Remove(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := false
+	for _, key := range keys {
+		for i := 0; i < m.replicas; i++ {
+			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			if m.hashMap[hash] == key {
+				delete(m.hashMap, hash)
+				removed = true
+			}
+		}
+	}
+	if !removed {
+		return
+	}
+	// 过滤掉已被删除的虚拟节点，过滤后的 keys 仍然是有序的
+	hashes := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	m.keys = hashes
+}
+
+// Replicas returns the number of virtual nodes of each real node.
+func (m *Map) Replicas() int {
+	return m.replicas
+}
+
+// Nodes returns the distinct real nodes in the hash, sorted by name.
+func (m *Map) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]bool)
+	nodes := make([]string, 0)
+	for _, node := range m.hashMap {
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// SetKeyFunc sets the function which derives the part of a key used for hashing in Get.
+// 例如 user:123:profile 与 user:123:settings 都提取出 user:123，就会被映射到同一个节点上。
+// 只作用于 Get，Add 和 Remove 仍然使用完整的节点名称。fn 为 nil 表示使用完整的 key
+func (m *Map) SetKeyFunc(fn func(key string) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyFunc = fn
+}
+
 // Get gets the closest node in the hash for the provided key
 // Get 根据要查询的数据的key选择节点。顺时针寻找
 func (m *Map) Get(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if len(m.keys) == 0 {
 		return ""
 	}
+	if m.keyFunc != nil {
+		key = m.keyFunc(key)
+	}
 	hash := int(m.hash([]byte(key)))
 	if hash > m.keys[len(m.keys)-1] {
 		return m.hashMap[m.keys[0]]
@@ -61,3 +131,63 @@ func (m *Map) Get(key string) string {
 	}
 	return ""
 }
+
+// GetN gets at most n distinct real nodes clockwise from the key's hash position
+// 第一个节点与 Get 返回的节点相同，其余节点可以在前面的节点不可用时作为备选。
+// n 大于真实节点的个数时，返回所有的真实节点，不会重复
+func (m *Map) GetN(key string, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if m.keyFunc != nil {
+		key = m.keyFunc(key)
+	}
+	hash := int(m.hash([]byte(key)))
+	start := sort.SearchInts(m.keys, hash)
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(start+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// clone 返回哈希环的副本，修改副本不会影响 m
+func (m *Map) clone() *Map {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := &Map{
+		replicas: m.replicas,
+		keys:     append([]int(nil), m.keys...),
+		hash:     m.hash,
+		hashMap:  make(map[int]string, len(m.hashMap)),
+		keyFunc:  m.keyFunc,
+	}
+	for hash, node := range m.hashMap {
+		c.hashMap[hash] = node
+	}
+	return c
+}
+
+// RebalancePlan reports where sampleKeys would move if the nodes in add were added and the nodes in remove were removed,
+// without mutating the ring. 返回值只包含会迁移的 key，映射到迁移后的节点，迁移前的节点即当前 Get 的结果。
+// 迁移的 key 数占 sampleKeys 的比例可以用来估计节点变化后的缓存未命中率
+func (m *Map) RebalancePlan(add, remove []string, sampleKeys []string) map[string]string {
+	before := m.clone()
+	after := before.clone()
+	after.Remove(remove...)
+	after.Add(add...)
+	moves := make(map[string]string)
+	for _, key := range sampleKeys {
+		if to := after.Get(key); to != before.Get(key) {
+			moves[key] = to
+		}
+	}
+	return moves
+}
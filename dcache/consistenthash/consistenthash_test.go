@@ -1,7 +1,14 @@
 package consistenthash
 
 import (
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -30,3 +37,292 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点为 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("2", "4", "6")
+	hash.Remove("4")
+	testcases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"11": "2",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testcases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, expect %s, get %s", k, v, hash.Get(k))
+		}
+	}
+
+	// 移除不存在的节点是一个空操作
+	hash.Remove("8")
+	if hash.Get("3") != "6" {
+		t.Errorf("Remove a missing node should be a no-op")
+	}
+
+	hash.Remove("2", "6")
+	if hash.Get("3") != "" {
+		t.Errorf("Asking for 3 on an empty ring, expect empty, get %s", hash.Get("3"))
+	}
+}
+
+// TestConcurrentUpdate 在节点不断增删的同时并发查询，需要使用 go test -race 运行
+func TestConcurrentUpdate(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("node-a", "node-b")
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := strconv.Itoa(j)
+				// node-a 与 node-b 始终在哈希环中，查询结果不会为空
+				if node := hash.Get(key); node == "" {
+					t.Errorf("Asking for %s during update, get empty node", key)
+					return
+				}
+				hash.GetN(key, 2)
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		node := "node-" + strconv.Itoa(i)
+		hash.Add(node)
+		hash.Nodes()
+		hash.Remove(node)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestNodes(t *testing.T) {
+	hash := New(3, nil)
+	hash.Add("node2", "node1", "node3")
+	hash.Remove("node3")
+	if expect := []string{"node1", "node2"}; !reflect.DeepEqual(hash.Nodes(), expect) {
+		t.Errorf("expect nodes %v, get %v", expect, hash.Nodes())
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点为 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("2", "4", "6")
+	testcases := map[string][]string{
+		"3":  {"4", "6", "2"},
+		"11": {"2", "4", "6"},
+		"25": {"6", "2", "4"},
+		"27": {"2", "4", "6"},
+	}
+	for k, v := range testcases {
+		if got := hash.GetN(k, 3); !reflect.DeepEqual(got, v) {
+			t.Errorf("Asking for %s, expect %v, get %v", k, v, got)
+		}
+		if got := hash.GetN(k, 1); got[0] != hash.Get(k) {
+			t.Errorf("GetN(%s, 1) should equal Get, expect %s, get %v", k, hash.Get(k), got)
+		}
+	}
+	// n 大于真实节点个数时返回所有节点，不重复
+	if got := hash.GetN("3", 10); !reflect.DeepEqual(got, []string{"4", "6", "2"}) {
+		t.Errorf("Asking for 10 nodes, expect all 3 distinct nodes, get %v", got)
+	}
+	if got := New(3, nil).GetN("3", 2); got != nil {
+		t.Errorf("Asking on an empty ring, expect nil, get %v", got)
+	}
+}
+
+func TestFNV1a(t *testing.T) {
+	for _, s := range []string{"", "a", "http://localhost:8001"} {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		if FNV1a([]byte(s)) != h.Sum32() {
+			t.Errorf("FNV1a(%q) should equal hash/fnv", s)
+		}
+	}
+}
+
+// imbalance 返回 n 个顺序递增的整数 key 在各节点之间分布的变异系数（标准差 / 平均值），越小越均衡
+func imbalance(fn Hash, nodes []string, n int) float64 {
+	m := New(50, fn)
+	m.Add(nodes...)
+	counts := make(map[string]int, len(nodes))
+	for i := 0; i < n; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	mean := float64(n) / float64(len(nodes))
+	var variance float64
+	for _, node := range nodes {
+		d := float64(counts[node]) - mean
+		variance += d * d
+	}
+	return math.Sqrt(variance/float64(len(nodes))) / mean
+}
+
+func TestHashBalance(t *testing.T) {
+	// main.go 中的三节点集群，顺序递增的 key 在 crc32 下分布偏差约 16%，xxHash 约 6%
+	nodes := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	crc, xx := imbalance(crc32.ChecksumIEEE, nodes, 100000), imbalance(XXHash, nodes, 100000)
+	if xx >= crc {
+		t.Fatalf("expect XXHash to balance sequential keys better than crc32, got %.3f vs %.3f", xx, crc)
+	}
+}
+
+func BenchmarkHashBalance(b *testing.B) {
+	nodes := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	for name, fn := range map[string]Hash{"crc32": crc32.ChecksumIEEE, "FNV1a": FNV1a, "XXHash": XXHash} {
+		b.Run(name, func(b *testing.B) {
+			var cv float64
+			for i := 0; i < b.N; i++ {
+				cv = imbalance(fn, nodes, 10000)
+			}
+			b.ReportMetric(cv, "cv")
+		})
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("node1", "node2", "node3", "node4")
+	// 只使用前两段作为hash的输入，user:<id> 相同的 key 落在同一个节点上
+	hash.SetKeyFunc(func(key string) string {
+		if parts := strings.SplitN(key, ":", 3); len(parts) == 3 {
+			return parts[0] + ":" + parts[1]
+		}
+		return key
+	})
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		if profile, settings := hash.Get("user:"+id+":profile"), hash.Get("user:"+id+":settings"); profile != settings {
+			t.Fatalf("keys of user %s should be co-located, but got %s and %s", id, profile, settings)
+		}
+		if hash.Get("user:"+id+":profile") != hash.Get("user:"+id) {
+			t.Fatalf("key func should be applied before hashing")
+		}
+	}
+}
+
+func TestRebalancePlan(t *testing.T) {
+	newRing := func() *Map {
+		hash := New(3, func(key []byte) uint32 {
+			i, _ := strconv.Atoi(string(key))
+			return uint32(i)
+		})
+		// 虚拟节点为 2, 4, 6, 12, 14, 16, 22, 24, 26
+		hash.Add("2", "4", "6")
+		return hash
+	}
+	var samples []string
+	for i := 0; i < 30; i++ {
+		samples = append(samples, strconv.Itoa(i))
+	}
+	hash := newRing()
+	plan := hash.RebalancePlan([]string{"8"}, []string{"4"}, samples)
+	// 计划不会修改哈希环
+	if !reflect.DeepEqual(hash.Nodes(), []string{"2", "4", "6"}) {
+		t.Fatalf("expect the ring to be unchanged, but got nodes %v", hash.Nodes())
+	}
+
+	actual := newRing()
+	actual.Remove("4")
+	actual.Add("8")
+	for _, key := range samples {
+		from, to := hash.Get(key), actual.Get(key)
+		moved, ok := plan[key]
+		if (from != to) != ok || (ok && moved != to) {
+			t.Errorf("key %s moves from %s to %s, but the plan reports %q, %v", key, from, to, moved, ok)
+		}
+	}
+	// 3, 4 由 4 迁移到 6；7, 8 由 12 所属的 2 迁移到 8
+	if plan["3"] != "6" || plan["8"] != "8" || len(plan) == 0 {
+		t.Fatalf("unexpected plan %v", plan)
+	}
+}
+
+func TestJumpMap(t *testing.T) {
+	m := NewJump(nil)
+	if m.Get("Tom") != "" {
+		t.Fatalf("empty map should return no node")
+	}
+	nodes := make([]string, 10)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i)
+	}
+	m.Add(nodes...)
+	m.Add(nodes[0]) // 重复添加的节点被忽略
+	if !reflect.DeepEqual(m.Nodes(), nodes) {
+		t.Fatalf("expect nodes in bucket order, but got %v", m.Nodes())
+	}
+
+	// 分布均匀：每个节点分到的 key 与平均值相差不超过 5%
+	const keys = 100000
+	before := make(map[string]string, keys)
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		before[key] = m.Get(key)
+		counts[before[key]]++
+	}
+	mean := float64(keys) / float64(len(nodes))
+	for node, count := range counts {
+		if math.Abs(float64(count)-mean)/mean > 0.05 {
+			t.Fatalf("%s owns %d keys, expect about %.0f", node, count, mean)
+		}
+	}
+
+	// 增加一个桶时只有约 1/11 的 key 移动，且都移动到新节点上
+	m.Add("http://10.0.0.10:8001")
+	moved := 0
+	for key, node := range before {
+		if owner := m.Get(key); owner != node {
+			moved++
+			if owner != "http://10.0.0.10:8001" {
+				t.Fatalf("key %s moved from %s to an old node %s", key, node, owner)
+			}
+		}
+	}
+	if expect := keys / 11; math.Abs(float64(moved-expect))/float64(expect) > 0.1 {
+		t.Fatalf("expect about %d keys to move, but %d moved", expect, moved)
+	}
+
+	// Replace 让新节点接管故障节点的桶，其他 key 不受影响
+	for key := range before {
+		before[key] = m.Get(key)
+	}
+	if !m.Replace(nodes[3], "http://10.0.1.3:8001") || m.Replace("unknown", "http://10.0.1.4:8001") {
+		t.Fatalf("unexpected result of Replace")
+	}
+	for key, node := range before {
+		expect := node
+		if node == nodes[3] {
+			expect = "http://10.0.1.3:8001"
+		}
+		if owner := m.Get(key); owner != expect {
+			t.Fatalf("expect %s on %s after Replace, but got %s", key, expect, owner)
+		}
+	}
+}
+
+func BenchmarkJumpMapGet(b *testing.B) {
+	m := NewJump(nil)
+	for i := 0; i < 1000; i++ {
+		m.Add(fmt.Sprintf("http://10.0.%d.%d:8001", i/256, i%256))
+	}
+	for i := 0; i < b.N; i++ {
+		m.Get(strconv.Itoa(i))
+	}
+}
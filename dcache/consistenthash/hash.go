@@ -0,0 +1,24 @@
+package consistenthash
+
+import "github.com/cespare/xxhash/v2"
+
+// 可选的哈希函数。默认的 crc32.ChecksumIEEE 对于顺序递增的 key（如自增 ID）分布可能不够均匀，
+// 可以通过 New 或 HTTPPoolOptions.HashFn 替换为以下的哈希函数。哈希环的均衡程度同时取决于节点名称与虚拟节点个数，
+// 替换前最好使用实际的节点名称与 key 验证分布情况。集群中所有节点必须使用相同的哈希函数。
+
+// FNV1a is the 32-bit FNV-1a hash, it does not allocate.
+// FNV-1a 的雪崩效应较弱，节点名称只相差一个字符时（如 localhost:8001 与 localhost:8002）虚拟节点可能聚集，
+// 此时分布反而不如 crc32
+func FNV1a(data []byte) uint32 {
+	h := uint32(2166136261)
+	for _, b := range data {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return h
+}
+
+// XXHash is the low 32 bits of the 64-bit xxHash.
+func XXHash(data []byte) uint32 {
+	return uint32(xxhash.Sum64(data))
+}
@@ -0,0 +1,100 @@
+package consistenthash
+
+import (
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// 跳跃一致性哈希（Jump Consistent Hash, Lamping & Veach 2014）：key 直接映射到 [0, n) 中的一个桶，
+// 不需要虚拟节点，除了节点列表之外几乎不占用内存，分布也比虚拟节点更均匀；桶从 n 个增加到 n+1 个时只有 1/(n+1) 的 key 会移动。
+// 代价是桶只能按照序号在末尾增加，不能删除中间的节点：Add 按顺序为节点分配桶，节点故障时通过 Replace 让新节点接管它的桶。
+
+// JumpMap maps keys to nodes with jump consistent hash, it is an alternative to Map for large clusters.
+// 与 Map 相同，可以被多个 goroutine 并发使用
+type JumpMap struct {
+	mu      sync.RWMutex
+	hash    func(data []byte) uint64
+	nodes   []string       // 桶的序号到节点的映射
+	buckets map[string]int // 节点到桶的序号的映射，用于去重与 Replace
+	keyFunc func(key string) string
+}
+
+// NewJump creates a JumpMap, fn is used to hash keys before jumping, nil means the 64-bit xxHash.
+func NewJump(fn Hash) *JumpMap {
+	m := &JumpMap{hash: xxhash.Sum64, buckets: make(map[string]int)}
+	if fn != nil {
+		m.hash = func(data []byte) uint64 { return uint64(fn(data)) }
+	}
+	return m
+}
+
+// Add appends nodes as new buckets, nodes which are already in the map are ignored.
+// 节点的顺序决定了桶的序号，集群中所有节点需要按照相同的顺序添加
+func (m *JumpMap) Add(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := m.buckets[node]; ok {
+			continue
+		}
+		m.buckets[node] = len(m.nodes)
+		m.nodes = append(m.nodes, node)
+	}
+}
+
+// Replace lets node take over the bucket of old, keys mapped to old are mapped to node afterwards.
+// old 不存在或者 node 已经存在时返回 false
+func (m *JumpMap) Replace(old, node string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[old]
+	if !ok {
+		return false
+	}
+	if _, ok := m.buckets[node]; ok {
+		return false
+	}
+	delete(m.buckets, old)
+	m.buckets[node] = bucket
+	m.nodes[bucket] = node
+	return true
+}
+
+// SetKeyFunc sets the function which derives the part of a key used for hashing in Get, see Map.SetKeyFunc.
+func (m *JumpMap) SetKeyFunc(fn func(key string) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyFunc = fn
+}
+
+// Get gets the node of the bucket which key jumps to, it returns "" if there are no nodes.
+func (m *JumpMap) Get(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	if m.keyFunc != nil {
+		key = m.keyFunc(key)
+	}
+	return m.nodes[jump(m.hash([]byte(key)), len(m.nodes))]
+}
+
+// Nodes returns the nodes ordered by their buckets.
+func (m *JumpMap) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.nodes...)
+}
+
+// jump 返回 key 在 n 个桶中所属的桶的序号，n 必须大于 0
+func jump(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
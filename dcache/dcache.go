@@ -3,9 +3,16 @@ package dcache
 import (
 	pb "DCache/dcache/dcachepb"
 	"DCache/dcache/singleflight"
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 // Group 是 DCache 最核心的数据结构，负责与用户的交互，并且控制缓存值存储和获取的流程。
@@ -27,6 +34,11 @@ import (
 // 不应该，一是数据源的种类太多，没办法一一实现；二是扩展性不好。如何从源头获取数据，应该是用户决定的事情，我们就把这件事交给用户好了。
 // 因此，我们设计了一个回调函数(callback)，在缓存不存在时，调用这个函数，得到源数据。
 
+// ErrNotFound is returned when the key does not exist in the data source.
+// 回调函数应当在数据源中不存在 key 时返回 ErrNotFound（或使用 %w 包装 ErrNotFound 的错误），
+// 从而使调用方能够区分"key 不存在"与"数据源故障"，HTTPPool 也会据此返回 404 而不是 500。
+var ErrNotFound = errors.New("not found")
+
 // A Getter loads data for a key.
 type Getter interface {
 	Get(key string) ([]byte, error)
@@ -44,6 +56,45 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// A GetterContext loads data for a key, and aborts when ctx is cancelled.
+// 如果回调需要访问较慢的数据源（如数据库），实现该接口可以在请求被取消时及时停止加载。
+type GetterContext interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// A GetterContextFunc implements GetterContext and Getter with a function.
+type GetterContextFunc func(ctx context.Context, key string) ([]byte, error)
+
+// GetContext implements GetterContext interface function
+func (f GetterContextFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// Get implements Getter interface function
+func (f GetterContextFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// A GetterWithTTL loads data for a key along with its time-to-live.
+// 数据源中的记录有各自的过期时间时实现该接口，缓存的记录会在 ttl 后过期；ttl <= 0 表示使用 Group 默认的过期策略。
+type GetterWithTTL interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// A GetterWithTTLFunc implements GetterWithTTL and Getter with a function.
+type GetterWithTTLFunc func(key string) ([]byte, time.Duration, error)
+
+// GetWithTTL implements GetterWithTTL interface function
+func (f GetterWithTTLFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// Get implements Getter interface function
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
 // A Group is a cache namespace.
 // 一个 Group 可以认为是一个缓存的命名空间，每个 Group 拥有一个唯一的名称 name。
 // 比如可以创建三个 Group，缓存学生的成绩命名为 scores，缓存学生信息的命名为 info，缓存学生课程的命名为 courses。
@@ -53,8 +104,52 @@ type Group struct {
 	name      string
 	getter    Getter
 	mainCache cache
-	peers     PeerPicker
+	peers     PeerPicker   // 第一层节点，写入、删除、Has 与 GetMulti 只访问这一层
+	tiers     []PeerPicker // 读取时在 peers 之后依次尝试的其他层级
 	sf        *singleflight.Group
+	stats     Stats
+	// compressMin 为压缩阈值，不小于该值的缓存值会被压缩后存储，0 表示不压缩
+	compressMin int
+	logger      Logger
+	// negativeTTL 为负缓存的过期时间，0 表示不缓存 ErrNotFound
+	negativeTTL time.Duration
+	classifier  ErrorClassifier // 为 nil 时只缓存 ErrNotFound，不重试
+	// defaultValue 为 key 不存在时返回的默认值，为 nil 时返回 ErrNotFound
+	defaultValue []byte
+	// softTTL, hardTTL 为 stale-while-revalidate 的软过期与硬过期时间，0 表示不启用
+	softTTL, hardTTL time.Duration
+	// maxValueBytes 为单条记录的大小上限，0 表示只受缓存容量的限制
+	maxValueBytes int64
+	maxKeyBytes   int // key 的长度上限，0 表示不限制
+	tracer        trace.Tracer
+	ttlJitter     float64       // 过期时间的随机抖动比例，0 表示不抖动
+	limiter       *rate.Limiter // 限制调用回调函数的速率，为 nil 时不限制
+	loadSem       chan struct{} // 限制同时进行的加载数的信号量，为 nil 时不限制
+	// noFallbackLocal 为 true 时，远程节点获取失败后直接返回错误，不回退到本地调用回调函数
+	noFallbackLocal bool
+	// serveStaleOnError 为 true 时，过期的值保留在缓存中，回调函数返回错误时代替错误返回
+	serveStaleOnError bool
+	// l1 缓存从远程节点获取到的值，l1TTL 为其过期时间，为 nil 时不启用
+	l1    *cache
+	l1TTL time.Duration
+	// hot 保存归属于远程节点的热点 key 的副本，hotKeys 统计访问频率，为 nil 时不启用
+	hot       *cache
+	hotKeys   *hotKeys
+	hotTTL    time.Duration
+	persister atomic.Pointer[persister] // 将缓存内容异步写入磁盘，为 nil 时不持久化，ClosePersistence 后重新置为 nil
+	tags      *tagIndex                 // 标签的反向索引，第一次调用 SetWithTags 时创建
+	tagsOnce  sync.Once
+}
+
+// Stats are per-group statistics.
+// Stats 记录了 Group 的缓存命中情况，所有计数器均通过 sync/atomic 更新，保证热路径上无锁。
+type Stats struct {
+	LocalHits int64 `json:"local_hits"` // 本地缓存命中的次数
+	Misses    int64 `json:"misses"`     // 本地缓存未命中，需要从远程节点或数据源获取的次数
+	PeerHits  int64 `json:"peer_hits"`  // 从远程节点成功获取的次数
+	Loads     int64 `json:"loads"`      // 调用回调函数从数据源获取的次数
+	Errors    int64 `json:"errors"`     // Get 返回错误的次数
+	Evictions int64 `json:"evictions"`  // 因容量不足被淘汰的记录数
 }
 
 var (
@@ -63,19 +158,58 @@ var (
 )
 
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return NewGroupWithPolicy(name, cacheBytes, getter, LRUPolicy)
+}
+
+// NewGroupWithPolicy creates a Group whose cache evicts entries with the policy created by newPolicy.
+// 例如可以传入 lfu 的构造函数，使热点 key 不会因为大量一次性访问而被淘汰。
+func NewGroupWithPolicy(name string, cacheBytes int64, getter Getter, newPolicy PolicyFactory) *Group {
+	g := newGroup(name, cacheBytes, getter, newPolicy)
+	registerGroup(g)
+	return g
+}
+
+// NewGroupSharded creates a Group whose cache is split into shards, each shard has its own lock.
+// 单个锁在多核高并发下会成为瓶颈，分片后不同分片的 key 可以并发读写。cacheBytes 平均分配给各个分片，
+// 因此单个分片写满时即会淘汰，即使其他分片仍有空间。
+func NewGroupSharded(name string, cacheBytes int64, shards int, getter Getter) *Group {
+	return NewGroupShardedWithPolicy(name, cacheBytes, shards, getter, LRUPolicy)
+}
+
+// NewGroupShardedWithPolicy creates a sharded Group like NewGroupSharded, each shard evicts entries with the policy created by newPolicy.
+func NewGroupShardedWithPolicy(name string, cacheBytes int64, shards int, getter Getter, newPolicy PolicyFactory) *Group {
+	if shards <= 0 {
+		panic("shards must be positive")
+	}
+	g := newGroup(name, cacheBytes, getter, newPolicy)
+	g.mainCache.shards = newShards(cacheBytes, shards, newPolicy)
+	registerGroup(g)
+	return g
+}
+
+// newGroup 创建一个尚未注册的 Group，调用方完成初始化之后再调用 registerGroup，
+// 避免其他 goroutine 通过 GetGroup 或 expvar 访问到初始化了一半的 Group
+func newGroup(name string, cacheBytes int64, getter Getter, newPolicy PolicyFactory) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	return &Group{
+		name:        name,
+		getter:      getter,
+		mainCache:   cache{cacheBytes: cacheBytes, newPolicy: newPolicy},
+		sf:          &singleflight.Group{},
+		logger:      noopLogger{},
+		tracer:      defaultTracer(),
+		maxKeyBytes: defaultMaxKeyBytes,
+	}
+}
+
+// registerGroup 使 g 可以通过 GetGroup 访问，并发布到 expvar
+func registerGroup(g *Group) {
 	mu.Lock()
 	defer mu.Unlock()
-	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		sf:        &singleflight.Group{},
-	}
-	groups[name] = g
-	return g
+	groups[g.name] = g
+	publishExpvar(g)
 }
 
 // GetGroup returns the named group previously created with NewGroup, or
@@ -87,60 +221,442 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Name returns the name of the group
+func (g *Group) Name() string {
+	return g.name
+}
+
 // Get value for a key from cache
 // Get 是最核心的函数，实现了上面的(1)(2)(3)。这里是整个分布式缓存系统的入口
 func (g *Group) Get(key string) (ByteView, error) {
-	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，ctx 会一路传递到回调函数与远程节点的 HTTP 请求中，ctx 被取消时加载过程会随之中止。
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	value, _, err := g.get(ctx, key, true)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return value.decompress()
+}
+
+// GetString gets the value for a key as a string.
+func (g *Group) GetString(key string) (string, error) {
+	view, err := g.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return view.String(), nil
+}
+
+// GetBytes gets the value for a key as a copy of its bytes, the same as Get followed by ByteSlice.
+// 返回的切片是缓存值的拷贝，调用方可以任意修改；压缩的缓存值解压后直接返回，比 Get().ByteSlice() 少一次拷贝
+func (g *Group) GetBytes(key string) ([]byte, error) {
+	value, _, err := g.get(context.Background(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	if value.compressed {
+		// 解压得到的是新分配的内存，无需再拷贝
+		value, err = value.decompress()
+		return value.b, err
+	}
+	return cloneBytes(value.b), nil
+}
+
+// GetInto gets the value for a key and copies it into dst, returns the length of the value.
+// 在热路径上复用调用方的缓冲区，避免 ByteSlice 每次分配新的内存。
+// dst 容纳不下时只拷贝 len(dst) 个字节，返回完整的长度与 io.ErrShortBuffer，调用方可以据此扩容后重试
+func (g *Group) GetInto(key string, dst []byte) (int, error) {
+	view, err := g.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if copy(dst, view.b) < view.Len() {
+		return view.Len(), io.ErrShortBuffer
+	}
+	return view.Len(), nil
+}
+
+// get 在 usePeers 为 false 时只从本节点获取，用于响应远程节点的请求。返回的 ByteView 可能是压缩后的数据
+func (g *Group) get(ctx context.Context, key string, usePeers bool) (value ByteView, source Source, err error) {
+	ctx, span := g.tracer.Start(ctx, "dcache.Group.Get", trace.WithAttributes(attrGroup.String(g.name), attrKey.String(key)))
+	defer func() { endSpan(span, err) }()
+	if err := g.checkKey(key); err != nil {
+		atomic.AddInt64(&g.stats.Errors, 1)
+		return ByteView{}, SourceLocalCache, err
 	}
 	// 检查是否被缓存
-	if v, ok := g.mainCache.get(key); ok {
+	if v, ok := g.lookupCache(key); ok {
 		// 发现本地有缓存，直接返回
-		log.Println("[GeeCache] hit")
-		return v, nil
+		span.SetAttributes(attrHit.Bool(true))
+		atomic.AddInt64(&g.stats.LocalHits, 1)
+		g.logger.Printf("[dcache] hit %s", key)
+		if v.err != nil {
+			if def, ok := g.defaultFor(v.err); ok {
+				return def, SourceLocalCache, nil
+			}
+			atomic.AddInt64(&g.stats.Errors, 1)
+			return ByteView{}, SourceLocalCache, v.err
+		}
+		return v, SourceLocalCache, nil
+	}
+	if usePeers {
+		// 归属于远程节点的 key 可能缓存在 L1 中
+		if v, ok := g.lookupL1(key); ok {
+			span.SetAttributes(attrHit.Bool(true))
+			atomic.AddInt64(&g.stats.LocalHits, 1)
+			return v, SourceLocalCache, nil
+		}
+		if v, ok := g.lookupHot(key); ok {
+			span.SetAttributes(attrHit.Bool(true))
+			atomic.AddInt64(&g.stats.LocalHits, 1)
+			return v, SourceLocalCache, nil
+		}
 	}
 	// 本地没有缓存，尝试从数据库读取数据或者从其他缓存节点读取
-	return g.load(key)
+	span.SetAttributes(attrHit.Bool(false))
+	atomic.AddInt64(&g.stats.Misses, 1)
+	if usePeers {
+		value, source, err = g.load(ctx, key)
+	} else {
+		value, err = g.getLocally(ctx, key)
+		source = SourceGetter
+	}
+	if err != nil {
+		if stale, ok := g.staleOnError(ctx, key, err); ok {
+			return stale, SourceLocalCache, nil
+		}
+		if def, ok := g.defaultFor(err); ok {
+			return def, source, nil
+		}
+		atomic.AddInt64(&g.stats.Errors, 1)
+	}
+	return value, source, err
 }
 
 // load 先判断是否可以从其他节点获取数据，如果可以则尝试获取。如果不可以，则尝试从本地获取
 // load 使用 PickPeer() 方法选择节点，若非本机节点，则调用 getFromPeer() 从远程获取。若是本机节点或失败，则回退到 getLocally()
-func (g *Group) load(key string) (value ByteView, err error) {
-	if g.peers != nil {
+// 注册了多个层级时，按照注册的顺序依次尝试每一层，前一层未命中或失败时再访问下一层
+func (g *Group) load(ctx context.Context, key string) (value ByteView, source Source, err error) {
+	ctx, span := g.tracer.Start(ctx, "dcache.Group.load", trace.WithAttributes(attrGroup.String(g.name), attrKey.String(key)))
+	defer func() { endSpan(span, err) }()
+	var notFound, peerErr error
+	var hot, counted bool
+	for i := 0; i <= len(g.tiers); i++ {
+		picker := g.peers
+		if i > 0 {
+			picker = g.tiers[i-1]
+		}
+		if picker == nil {
+			continue
+		}
 		// 判断是否可以从其他缓存节点获取缓存
-		if peer, ok := g.peers.PickPeer(key); ok {
-			ret, err := g.sf.Do(key, func() (interface{}, error) {
-				value, err := g.GetFromPeer(peer, key)
-				if err != nil {
-					log.Println("[dcache] Failed to get from peer, try to get locally.", err)
+		peer, ok := picker.PickPeer(key)
+		if !ok {
+			continue
+		}
+		span.SetAttributes(attrPeer.Bool(true))
+		if !counted {
+			hot, counted = g.recordAccess(key), true
+		}
+		ret, err := g.sf.DoContext(ctx, tierFlightKey(i, key), func() (interface{}, error) {
+			value, err := g.GetFromPeer(ctx, peer, key)
+			if err == nil {
+				atomic.AddInt64(&g.stats.PeerHits, 1)
+				g.populateL1(key, value)
+				if hot {
+					g.replicateHot(key, value)
 				}
-				return value, nil
-			})
-			return ret.(ByteView), err
+			}
+			return value, err
+		})
+		if err == nil {
+			return ret.(ByteView), SourcePeer, nil
+		}
+		if ctx.Err() != nil {
+			// 请求已被取消，无需再访问其他层级或者回退到本地获取
+			return ByteView{}, SourcePeer, err
+		}
+		if errors.Is(err, ErrNotFound) {
+			notFound = err
+			continue
 		}
+		g.logger.Printf("[dcache] Failed to get from peer: %v", err)
+		span.AddEvent("peer failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		peerErr = err
 	}
-	return g.getLocally(key)
+	if notFound != nil {
+		// 远程节点确认 key 不存在，无需再回退到本地获取
+		return ByteView{}, SourcePeer, notFound
+	}
+	if peerErr != nil {
+		if g.noFallbackLocal {
+			return ByteView{}, SourcePeer, peerErr
+		}
+		// 远程节点获取失败（如节点宕机、返回 5xx），回退到本地获取，而不是返回一个空值
+		span.AddEvent("fallback to local getter")
+	}
+	value, err = g.getLocally(ctx, key)
+	return value, SourceGetter, err
+}
+
+// SetFallbackLocal sets whether to load the key locally when the owning peer fails, default is true.
+// 回退时每个节点都会各自访问数据源，远程节点宕机期间可能压垮数据源；
+// 关闭后 key 只会由归属节点从数据源加载，远程节点不可用时 Get 与 GetMulti 直接返回错误。
+func (g *Group) SetFallbackLocal(enabled bool) {
+	g.noFallbackLocal = !enabled
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.sf.Do(key, func() (interface{}, error) {
-		return g.getter.Get(key)
+// getLocally 调用回调函数获取源数据并添加到缓存。
+// 加载期间如果 key 被 Delete，singleflight 会忘记这次加载，加载结果不会写回缓存，避免已删除的旧数据复活。
+// 加载在单独的 goroutine 中进行，调用方的 ctx 被取消时立即返回，加载继续进行，结果返回给其他等待的调用方并写回缓存；
+// 所有等待的调用方都取消后，回调函数的 ctx 同样被取消
+func (g *Group) getLocally(ctx context.Context, key string) (_ ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "dcache.Group.getLocally", trace.WithAttributes(attrGroup.String(g.name), attrKey.String(key)))
+	defer func() { endSpan(span, err) }()
+	value, err := g.sf.DoCommitContext(ctx, localFlightKey(key), func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt64(&g.stats.Loads, 1)
+		release, err := g.acquireLoad(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		// 版本取加载开始的时间：加载期间如果有更新的 Set，加载到的旧数据不会覆盖它
+		version := newVersion()
+		for attempt := 0; ; attempt++ {
+			if g.limiter != nil {
+				if err := g.waitGetter(ctx); err != nil {
+					return nil, err
+				}
+			}
+			bytes, ttl, err := g.callGetter(ctx, key)
+			if err == nil {
+				return ByteView{b: cloneBytes(bytes), version: version, ttl: ttl}, nil
+			}
+			cacheable, retry := g.classify(err)
+			if retry && getterRetry.wait(ctx, attempt+1) {
+				g.logger.Printf("[dcache] Failed to load %s, retry: %v", key, err)
+				continue
+			}
+			if cacheable && g.negativeTTL > 0 {
+				// 返回墓碑标记，使其与正常的值一样写回缓存
+				return ByteView{err: err, version: version}, nil
+			}
+			return nil, err
+		}
+	}, func(value interface{}) {
+		if err := g.populateCache(key, value.(ByteView)); err != nil {
+			// 值仍然返回给调用方，只是不写入缓存
+			g.logger.Printf("[dcache] Failed to cache %s: %v", key, err)
+		}
 	})
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes.([]byte))}
-	g.populateCache(key, value)
-	return value, nil
+	if value.(ByteView).err != nil {
+		return ByteView{}, value.(ByteView).err
+	}
+	return value.(ByteView), nil
+}
+
+// callGetter 调用回调函数获取源数据，实现了 GetterContext 的回调会收到 ctx，
+// 实现了 GetterWithTTL 的回调会同时返回记录的过期时间，否则 ttl 为 0
+func (g *Group) callGetter(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	switch getter := g.getter.(type) {
+	case GetterWithTTL:
+		return getter.GetWithTTL(key)
+	case GetterContext:
+		bytes, err := getter.GetContext(ctx, key)
+		return bytes, 0, err
+	}
+	bytes, err := g.getter.Get(key)
+	return bytes, 0, err
+}
+
+// Stats returns a snapshot of the group's statistics.
+func (g *Group) Stats() Stats {
+	return Stats{
+		LocalHits: atomic.LoadInt64(&g.stats.LocalHits),
+		Misses:    atomic.LoadInt64(&g.stats.Misses),
+		PeerHits:  atomic.LoadInt64(&g.stats.PeerHits),
+		Loads:     atomic.LoadInt64(&g.stats.Loads),
+		Errors:    atomic.LoadInt64(&g.stats.Errors),
+		Evictions: g.mainCache.evictionCount(),
+	}
+}
+
+// Keys returns a snapshot of the keys cached on this node, from oldest to newest.
+// 只包含本节点缓存的 key，不会访问远程节点，可用于调试或导出预热数据
+func (g *Group) Keys() []string {
+	return g.mainCache.keys()
+}
+
+// Range calls fn for each value cached on this node, from oldest to newest, until fn returns false.
+// 遍历期间持有缓存的读锁，fn 中不能再写入或删除本 Group 的 key，需要删除的 key 可以先收集起来，遍历结束后再删除。
+// 不会更新 key 的访问记录，不影响淘汰顺序；负缓存和已过期的记录会被跳过
+func (g *Group) Range(fn func(key string, value ByteView) bool) {
+	now := time.Now()
+	g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		if value.err != nil || value.expired(now) {
+			return true
+		}
+		return fn(key, value)
+	})
+}
+
+// Len returns the number of entries cached on this node.
+// 与 Keys 相同，负缓存的记录同样计算在内
+func (g *Group) Len() int {
+	return g.mainCache.len()
+}
+
+// Contains reports whether a value for key is cached on this node.
+// 只检查本节点的缓存，不会调用回调函数或访问远程节点，也不会更新 key 的访问记录，不影响淘汰顺序
+func (g *Group) Contains(key string) bool {
+	return g.hasLocally(key)
+}
+
+// CacheBytes returns the memory bytes used by the cache of this node.
+// 与 MaxBytes 一起可以计算缓存的使用率，用于扩缩容决策
+func (g *Group) CacheBytes() int64 {
+	return g.mainCache.bytes()
+}
+
+// MaxBytes returns the max memory bytes the cache of this node can use, 0 means unbounded.
+func (g *Group) MaxBytes() int64 {
+	return g.mainCache.cacheBytes
+}
+
+// newVersion 返回一个新的版本号，即当前的时间戳（纳秒）
+func newVersion() int64 {
+	return time.Now().UnixNano()
+}
+
+// populateCache 将 key, value 添加到缓存，value 比已缓存的版本旧时不会写入，
+// value 超过大小限制时不会写入，返回 ErrValueTooLarge
+func (g *Group) populateCache(key string, value ByteView) error {
+	_, err := g.addToCache(key, value)
+	return err
+}
+
+// addToCache 与 populateCache 相同，同时返回 value 是否被写入，value 比已缓存的版本旧时返回 false
+func (g *Group) addToCache(key string, value ByteView) (bool, error) {
+	if value.err != nil {
+		return g.mainCache.addWithTTL(key, value, g.jitter(g.negativeTTL)), nil
+	}
+	value = g.maybeCompress(value)
+	if err := g.checkSize(key, value); err != nil {
+		return false, err
+	}
+	if value.ttl > 0 {
+		// 回调函数返回的过期时间优先于 Group 的默认配置
+		if g.hardTTL > 0 && g.softTTL < value.ttl {
+			value.softExpire = time.Now().Add(g.softTTL)
+		}
+		return g.addExpiring(key, value, g.jitter(value.ttl)), nil
+	}
+	if g.hardTTL > 0 {
+		value.softExpire = time.Now().Add(g.softTTL)
+		return g.addExpiring(key, value, g.jitter(g.hardTTL)), nil
+	}
+	// 写入记录由 mainCache 在持有锁时通过 persistAdd 加入持久化队列
+	return g.mainCache.add(key, value), nil
 }
 
-// populateCache 将 key, value 添加到缓存
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// Set stores the value for key in the cache directly.
+// Set 是写穿透(write-through)的写入接口：如果 key 归属于远程节点，则将值转发给该节点，使其落在正确的节点上；
+// 如果 key 归属于本节点（或未注册远程节点），则直接写入本地缓存，不产生网络请求。
+func (g *Group) Set(key string, value []byte) error {
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	if g.peers != nil {
+		if peer, ok := g.pickPrimary(key); ok {
+			g.removeL1(key)
+			g.removeHot(key)
+			return peer.Set(context.Background(), &pb.Request{Group: g.name, Key: key, Value: value, Version: newVersion()})
+		}
+	}
+	return g.populateCache(key, ByteView{b: cloneBytes(value), version: newVersion()})
+}
+
+// Delete removes the key from the cache
+// Delete 将 key 从本地缓存中删除。如果注册了远程节点，且 key 归属于其他节点，则同时通知该节点删除。
+// 删除不存在的 key 不会报错。
+func (g *Group) Delete(key string) error {
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	g.removeLocally(key)
+	if g.peers != nil {
+		if peer, ok := g.pickPrimary(key); ok {
+			return peer.Delete(context.Background(), &pb.Request{Group: g.name, Key: key})
+		}
+	}
+	return nil
+}
+
+// removeLocally 只删除本地缓存，用于响应其他节点发来的删除请求
+func (g *Group) removeLocally(key string) {
+	g.sf.Forget(peerFlightKey(key))
+	g.sf.Forget(localFlightKey(key))
+	g.sf.Forget(computeFlightKey(key))
+	g.mainCache.remove(key)
+	g.removeL1(key)
+	g.removeHot(key)
+}
+
+// singleflight 的 key 按照加载路径加上不同的前缀。从远程节点获取与本地加载如果共用同一个 key，
+// 本节点正在等待远程节点返回 key 时，远程节点（哈希环不一致，或者就是本进程）又请求本节点加载同一个 key，
+// 本地加载会去等待那次远程获取，双方互相等待直到超时
+func peerFlightKey(key string) string {
+	return "peer:" + key
+}
+
+func localFlightKey(key string) string {
+	return "local:" + key
+}
+
+// Clear removes all keys cached on this node.
+// 正在进行中的加载也会被忘记，加载结束后不会再写回缓存
+func (g *Group) Clear() {
+	g.sf.ForgetAll()
+	g.mainCache.clear()
+	if g.l1 != nil {
+		g.l1.clear()
+	}
+	if g.hot != nil {
+		g.hot.clear()
+	}
+}
+
+// ClearAll clears the group on this node and broadcasts the clear to every remote peer.
+// 只有注册的 PeerPicker 实现了 PeerLister 时才会广播，否则只清空本节点。
+// 所有节点都会被通知，某些节点失败时返回合并后的错误。
+func (g *Group) ClearAll(ctx context.Context) error {
+	g.Clear()
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	peers := lister.Peers()
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer PeerGetter) {
+			defer wg.Done()
+			errs[i] = peer.Clear(ctx, &pb.Request{Group: g.name})
+		}(i, peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
 // RegisterPeers registers a PeerPicker for choosing remote peer
-// RegisterPeers 将实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中
+// RegisterPeers 将实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中，它是读取时尝试的第一层，其他层级通过 RegisterPeerTier 追加
 func (g *Group) RegisterPeers(peers PeerPicker) {
 	if g.peers != nil {
 		panic("RegisterPeerPicker called more than once")
@@ -149,15 +665,16 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 // GetFromPeer 使用实现了 PeerGetter 接口的 httpGetter 从访问远程节点，获取缓存值
-func (g *Group) GetFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) GetFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:            g.name,
+		Key:              key,
+		AcceptCompressed: true,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{res.Value}, nil
+	return ByteView{b: res.Value, compressed: res.Compressed, version: res.Version}.decompress()
 }
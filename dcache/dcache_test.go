@@ -1,10 +1,28 @@
 package dcache
 
 import (
+	pb "DCache/dcache/dcachepb"
+	"DCache/dcache/lfu"
+	"DCache/dcache/lru"
+	"DCache/dcache/twoq"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
+	"math/rand"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // 在这个测试用例中，我们借助 GetterFunc 的类型转换，将一个匿名回调函数转换成了接口 f Getter。
@@ -56,3 +74,2008 @@ func TestGet(t *testing.T) {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	for _, k := range []string{"Tom", "Tom", "Jack", "Tom", "unknown", ""} {
+		_, _ = g.Get(k)
+	}
+
+	expect := Stats{LocalHits: 2, Misses: 3, Loads: 3, Errors: 2}
+	if stats := g.Stats(); stats != expect {
+		t.Fatalf("expect stats %+v, but got %+v", expect, stats)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	g := NewGroup("keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if keys := g.Keys(); len(keys) != 0 {
+		t.Fatalf("empty group should have no keys, but got %v", keys)
+	}
+
+	for _, k := range []string{"Tom", "Jack", "Sam", "Tom"} {
+		_, _ = g.Get(k)
+	}
+	expect := []string{"Jack", "Sam", "Tom"}
+	if keys := g.Keys(); !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Keys() = %v, expect %v", keys, expect)
+	}
+}
+
+func TestRange(t *testing.T) {
+	g := NewGroup("range", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	for _, k := range []string{"Tom", "Jack", "Sam"} {
+		_, _ = g.Get(k)
+	}
+
+	var keys []string
+	g.Range(func(key string, value ByteView) bool {
+		if value.String() != key {
+			t.Fatalf("unexpected value %q for %s", value.String(), key)
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if expect := []string{"Tom", "Jack", "Sam"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Range visited %v, expect %v", keys, expect)
+	}
+	// Range 不会提升访问的记录
+	if expect := []string{"Tom", "Jack", "Sam"}; !reflect.DeepEqual(expect, g.Keys()) {
+		t.Fatalf("Range should not promote entries, but Keys() = %v", g.Keys())
+	}
+}
+
+func TestRangeStop(t *testing.T) {
+	g := NewGroup("range-stop", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	for _, k := range []string{"Tom", "Jack", "Sam"} {
+		_, _ = g.Get(k)
+	}
+
+	var keys []string
+	g.Range(func(key string, value ByteView) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if expect := []string{"Tom", "Jack"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Range visited %v, expect to stop after %v", keys, expect)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	a := NewGroup("prefix-a", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	b := NewGroup("prefix-b", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	getterB := NewLocalGetter()
+	getterB.AddGroup("prefix-a", b)
+	pool := NewLocalPool("a")
+	pool.Add("a", nil)
+	pool.Add("b", getterB)
+	a.RegisterPeers(pool)
+
+	var evicted []string
+	a.mainCache.setOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		evicted = append(evicted, key)
+	})
+	for _, key := range []string{"tenant:42:a", "tenant:7:a", "tenant:42:b", "tenant:420:a"} {
+		a.populateCache(key, ByteView{b: []byte(key)})
+	}
+	b.populateCache("tenant:42:c", ByteView{b: []byte("c")})
+	b.populateCache("tenant:7:c", ByteView{b: []byte("c")})
+
+	if n := a.DeletePrefix("tenant:42:"); n != 2 {
+		t.Fatalf("expect 2 keys deleted locally, but got %d", n)
+	}
+	if expect := []string{"tenant:7:a", "tenant:420:a"}; !reflect.DeepEqual(expect, a.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", a.Keys(), expect)
+	}
+	if expect := []string{"tenant:42:a", "tenant:42:b"}; !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("expect OnEvicted for %v, but got %v", expect, evicted)
+	}
+	// 删除会广播给远程节点
+	if expect := []string{"tenant:7:c"}; !reflect.DeepEqual(expect, b.Keys()) {
+		t.Fatalf("expect the prefix to be deleted on peer b, but got %v", b.Keys())
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	loads := 0
+	g := NewGroup("not-found", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}))
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound from getter, but got %v", err)
+	}
+
+	// 远程节点确认 key 不存在时，不再回退到本地加载
+	g.peers = &fakePeer{sets: make(map[string][]byte)}
+	loads = 0
+	if _, err := g.Get("Jack"); !errors.Is(err, ErrNotFound) || loads != 0 {
+		t.Fatalf("expect ErrNotFound from peer without local load, but got %v, %d loads", err, loads)
+	}
+}
+
+func TestPeerTiers(t *testing.T) {
+	loads := 0
+	g := NewGroup("peer-tiers", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, notFoundError(key)
+		}))
+	primary := &fakePeer{sets: make(map[string][]byte), local: map[string]bool{"Sam": true}}
+	replica := &fakePeer{sets: map[string][]byte{"Tom": []byte("630"), "Sam": []byte("567")}}
+	g.RegisterPeers(primary)
+	g.RegisterPeerTier(replica)
+
+	// 第一层未命中，由第二层返回
+	view, source, err := g.GetWithSource("Tom")
+	if err != nil || view.String() != "630" || source != SourcePeer {
+		t.Fatalf("expect Tom from the second tier, but got %q from %v, %v", view.String(), source, err)
+	}
+	if primary.gets != 1 || replica.gets != 1 {
+		t.Fatalf("expect each tier to be asked once, but got %d and %d", primary.gets, replica.gets)
+	}
+	// 第一层中 key 归属于本节点时，同样先访问第二层再调用回调函数
+	if view, err := g.Get("Sam"); err != nil || view.String() != "567" || loads != 0 {
+		t.Fatalf("expect Sam from the second tier, but got %q, %v after %d loads", view.String(), err, loads)
+	}
+	// 所有层级都未命中时返回 ErrNotFound，不回退到本地加载
+	if _, err := g.Get("Jack"); !errors.Is(err, ErrNotFound) || loads != 0 {
+		t.Fatalf("expect ErrNotFound from all tiers without local load, but got %v, %d loads", err, loads)
+	}
+}
+
+func TestCacheBytes(t *testing.T) {
+	g := NewGroup("cache-bytes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	if g.CacheBytes() != 0 || g.MaxBytes() != 2<<10 {
+		t.Fatalf("expect 0/%d bytes, but got %d/%d", 2<<10, g.CacheBytes(), g.MaxBytes())
+	}
+	_, _ = g.Get("Tom")
+	if expect := int64(len("Tom") + len(db["Tom"])); g.CacheBytes() != expect {
+		t.Fatalf("expect %d bytes, but got %d", expect, g.CacheBytes())
+	}
+}
+
+// captureLogger 记录所有日志，用于断言日志内容
+type captureLogger struct {
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestLogger(t *testing.T) {
+	g := NewGroup("logger", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	logger := &captureLogger{}
+	g.SetLogger(logger)
+
+	_, _ = g.Get("Tom")
+	if len(logger.lines) != 0 {
+		t.Fatalf("cache miss should not log a hit, but got %v", logger.lines)
+	}
+	_, _ = g.Get("Tom")
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "hit") {
+		t.Fatalf("cache hit should log a hit, but got %v", logger.lines)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	g := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "empty" {
+				return []byte{}, nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}))
+	g.SetNegativeCacheTTL(50 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, but got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("missing key should be loaded once, but got %d loads", loads)
+	}
+	// 墓碑标记与值为空的缓存值不同
+	if view, err := g.Get("empty"); err != nil || view.Len() != 0 {
+		t.Fatalf("empty value should not be treated as not found: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) || loads != 3 {
+		t.Fatalf("tombstone should expire after ttl, got %v with %d loads", err, loads)
+	}
+}
+
+func TestChainGetters(t *testing.T) {
+	calls := make([]string, 0)
+	redis := GetterFunc(func(key string) ([]byte, error) {
+		calls = append(calls, "redis")
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	})
+	sql := GetterFunc(func(key string) ([]byte, error) {
+		calls = append(calls, "sql")
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	})
+	g := NewGroup("chain", 2<<10, ChainGetters(redis, sql))
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect Tom to be loaded by the second getter, but got %q, %v", view.String(), err)
+	}
+	if expect := []string{"redis", "sql"}; !reflect.DeepEqual(expect, calls) {
+		t.Fatalf("expect getters called in order %v, but got %v", expect, calls)
+	}
+	if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound when all getters miss, but got %v", err)
+	}
+
+	outage := GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("database is down")
+	})
+	if _, err := ChainGetters(redis, outage).Get("Tom"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("backend failures should not be reported as not found, but got %v", err)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var version int64
+	refreshed := make(chan struct{}, 10)
+	g := NewGroup("stale", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			v := atomic.AddInt64(&version, 1)
+			defer func() { refreshed <- struct{}{} }()
+			return []byte(fmt.Sprintf("v%d", v)), nil
+		}))
+	g.SetStaleWhileRevalidate(20*time.Millisecond, time.Second)
+
+	if view, _ := g.Get("Tom"); view.String() != "v1" {
+		t.Fatalf("expect v1, but got %s", view.String())
+	}
+	<-refreshed
+	time.Sleep(30 * time.Millisecond)
+
+	// 软过期后的第一次读取立即返回旧值，并在后台刷新
+	if view, _ := g.Get("Tom"); view.String() != "v1" {
+		t.Fatalf("expect stale v1 after soft expiry, but got %s", view.String())
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("stale value should be refreshed in background")
+	}
+	// 回调函数返回后才会写回缓存，等待刷新后的值可见
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if view, _ := g.mainCache.get("Tom"); view.String() == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect refreshed v2 in cache")
+		}
+	}
+	if view, _ := g.Get("Tom"); view.String() != "v2" {
+		t.Fatalf("expect refreshed v2, but got %s", view.String())
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	loads := 0
+	g := NewGroup("default-value", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			if key == "broken" {
+				return nil, errors.New("db is down")
+			}
+			return nil, notFoundError(key)
+		}))
+	g.SetDefaultValue([]byte("{}"))
+	g.SetNegativeCacheTTL(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if view, err := g.Get("unknown"); err != nil || view.String() != "{}" {
+			t.Fatalf("expect the default value, but got %q, %v", view.String(), err)
+		}
+	}
+	// 默认值与负缓存一样被缓存，只加载一次
+	if loads != 1 {
+		t.Fatalf("missing key should be loaded once, but got %d loads", loads)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect the real value, but got %q, %v", view.String(), err)
+	}
+	if _, err := g.Get("broken"); err == nil {
+		t.Fatalf("expect other errors to be returned")
+	}
+	values, err := g.GetMulti([]string{"Tom", "missing"})
+	if err != nil || values["missing"].String() != "{}" {
+		t.Fatalf("expect GetMulti to return the default value, but got %v, %v", values, err)
+	}
+
+	g.SetDefaultValue(nil)
+	if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound after removing the default value, but got %v", err)
+	}
+}
+
+func TestErrorClassifier(t *testing.T) {
+	errTimeout := errors.New("database timeout")
+	errBadKey := errors.New("bad key format")
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	count := func(key string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts[key]
+	}
+	g := NewGroup("classifier", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[key]++
+			if key == "bad" {
+				return nil, errBadKey
+			}
+			if attempts[key] <= 2 {
+				return nil, errTimeout
+			}
+			return []byte("630"), nil
+		}))
+	g.SetNegativeCacheTTL(time.Minute)
+	g.SetErrorClassifier(func(err error) (bool, bool) {
+		return errors.Is(err, errBadKey), errors.Is(err, errTimeout)
+	})
+
+	// 暂时性错误会在退避后重试，失败两次后第三次成功
+	start := time.Now()
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" || count("Tom") != 3 {
+		t.Fatalf("expect Tom after 3 attempts, but got %q, %v after %d attempts", view.String(), err, count("Tom"))
+	}
+	if elapsed := time.Since(start); elapsed < 3*getterRetryBackoff {
+		t.Fatalf("expect retries to back off for at least %v, but took %v", 3*getterRetryBackoff, elapsed)
+	}
+	// 等待重试期间超过截止时间则不再重试
+	ctx, cancel := context.WithTimeout(context.Background(), getterRetryBackoff/2)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "Jack"); err == nil || count("Jack") != 1 {
+		t.Fatalf("expect no retry after the deadline, but got %v after %d attempts", err, count("Jack"))
+	}
+	// 永久性错误不会重试，并且被负缓存
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get("bad"); !errors.Is(err, errBadKey) {
+			t.Fatalf("expect errBadKey, but got %v", err)
+		}
+	}
+	if count("bad") != 1 {
+		t.Fatalf("permanent error should be cached, but getter was called %d times", count("bad"))
+	}
+}
+
+type student struct {
+	Name    string
+	Scores  map[string]int
+	Address struct {
+		City string
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	loads := 0
+	g := NewJSONGroup("typed", 2<<10, func(ctx context.Context, key string) (student, error) {
+		loads++
+		s := student{Name: key, Scores: map[string]int{"math": 630}}
+		s.Address.City = "Beijing"
+		return s, nil
+	})
+	for i := 0; i < 2; i++ {
+		s, err := g.Get("Tom")
+		if err != nil || s.Name != "Tom" || s.Scores["math"] != 630 || s.Address.City != "Beijing" {
+			t.Fatalf("unexpected student %+v, %v", s, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect getter to be called once, but got %d", loads)
+	}
+
+	jack := student{Name: "Jack", Scores: map[string]int{"math": 589}}
+	jack.Address.City = "Shanghai"
+	if err := g.Set("Jack", jack); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := g.Get("Jack"); err != nil || !reflect.DeepEqual(s, jack) {
+		t.Fatalf("expect %+v, but got %+v, %v", jack, s, err)
+	}
+	// 缓存中存储的是 JSON 编码后的字节
+	if view, err := g.Group.Get("Jack"); err != nil || !strings.Contains(view.String(), `"City":"Shanghai"`) {
+		t.Fatalf("expect JSON bytes in cache, but got %q, %v", view.String(), err)
+	}
+}
+
+func TestMaxKeyBytes(t *testing.T) {
+	var loads int
+	g := NewGroup("max-key-bytes", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("630"), nil
+	}))
+	long := strings.Repeat("k", defaultMaxKeyBytes+1)
+	if _, err := g.Get(long); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("expect ErrKeyTooLarge, but got %v", err)
+	}
+	if err := g.Set(long, []byte("630")); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("expect ErrKeyTooLarge on Set, but got %v", err)
+	}
+	if loads != 0 || len(g.Keys()) != 0 {
+		t.Fatalf("over-length keys should be rejected before loading or caching, got %d loads, keys %d", loads, len(g.Keys()))
+	}
+
+	// 关闭限制后可以正常获取
+	g.SetMaxKeyBytes(0)
+	if view, err := g.Get(long); err != nil || view.String() != "630" {
+		t.Fatalf("expect long key to be loaded without limit, but got %v", err)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	loads := 0
+	g := NewGroup("max-value", 64, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if key == "big" {
+			return bytes.Repeat([]byte("x"), 100), nil
+		}
+		return []byte(db[key]), nil
+	}))
+	for key := range db {
+		g.Get(key)
+	}
+	// 超过缓存容量的值仍然返回给调用方，但不会被缓存，也不会淘汰其他记录
+	for i := 0; i < 2; i++ {
+		if view, err := g.Get("big"); err != nil || view.Len() != 100 {
+			t.Fatalf("expect the big value to be returned, but got %d bytes, %v", view.Len(), err)
+		}
+	}
+	if loads != len(db)+2 {
+		t.Fatalf("big value should not be cached, expect %d loads, but got %d", len(db)+2, loads)
+	}
+	if keys := g.Keys(); len(keys) != len(db) {
+		t.Fatalf("nothing should be evicted, but got keys %v", keys)
+	}
+	if err := g.Set("big", bytes.Repeat([]byte("x"), 100)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge, but got %v", err)
+	}
+
+	g.SetMaxValueBytes(8)
+	if err := g.Set("Tom", []byte("too long")); !errors.Is(err, ErrValueTooLarge) || strings.Contains(err.Error(), "Tom") {
+		t.Fatalf("expect ErrValueTooLarge without the key in the message, but got %v", err)
+	}
+	if err := g.Set("Tom", []byte("631")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetterWithTTL(t *testing.T) {
+	loads := make(map[string]int)
+	g := NewGroup("getter-ttl", 2<<10, GetterWithTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		loads[key]++
+		switch key {
+		case "short":
+			return []byte("1"), 20 * time.Millisecond, nil
+		case "long":
+			return []byte("2"), time.Hour, nil
+		}
+		return []byte("3"), 0, nil
+	}))
+	for _, key := range []string{"short", "long", "forever"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+	for _, key := range []string{"short", "long", "forever"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expect := map[string]int{"short": 2, "long": 1, "forever": 1}; !reflect.DeepEqual(expect, loads) {
+		t.Fatalf("expect loads %v, but got %v", expect, loads)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	g := NewGroup("warm", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	err := g.Warm([]string{"Tom", "Jack", "Sam", "Unknown"})
+	failed, ok := err.(MultiError)
+	if !ok || len(failed) != 1 || !errors.Is(failed["Unknown"], ErrNotFound) {
+		t.Fatalf("expect only Unknown to fail, but got %v", err)
+	}
+	loads := g.Stats().Loads
+	for k, v := range db {
+		if view, err := g.Get(k); err != nil || view.String() != v {
+			t.Fatalf("failed to get value of %s", k)
+		}
+	}
+	if stats := g.Stats(); stats.Loads != loads || stats.LocalHits != int64(len(db)) {
+		t.Fatalf("warmed keys should be local hits, but got %+v", stats)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	g := NewGroup("ttl-jitter", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	if ttl := g.jitter(time.Minute); ttl != time.Minute {
+		t.Fatalf("jitter should be disabled by default, but got %v", ttl)
+	}
+	g.SetTTLJitter(0.2)
+
+	// 将 [0.8s, 1.2s] 等分为 10 个区间，期望每个区间约有 n/10 个样本，而不是集中在某个区间
+	const n, buckets = 10000, 10
+	counts := make([]int, buckets)
+	for i := 0; i < n; i++ {
+		ttl := g.jitter(time.Second)
+		if ttl < 800*time.Millisecond || ttl > 1200*time.Millisecond {
+			t.Fatalf("ttl %v is out of the jitter window", ttl)
+		}
+		b := int((ttl - 800*time.Millisecond) * buckets / (400 * time.Millisecond))
+		if b == buckets {
+			b--
+		}
+		counts[b]++
+	}
+	for b, count := range counts {
+		if count < n/buckets/2 || count > n/buckets*2 {
+			t.Fatalf("expirations should spread across the window, but bucket %d has %d of %d: %v", b, count, n, counts)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var version int64
+	refreshing, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("refresh", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if atomic.AddInt64(&version, 1) > 1 {
+			close(refreshing)
+			<-release // 模拟较慢的数据源
+		}
+		return []byte(strconv.FormatInt(atomic.LoadInt64(&version), 10)), nil
+	}))
+	if view, err := g.Get("Tom"); err != nil || view.String() != "1" {
+		t.Fatalf("expect 1, but got %q, %v", view.String(), err)
+	}
+
+	done := make(chan error)
+	go func() { done <- g.Refresh("Tom") }()
+	<-refreshing
+	// 刷新期间仍然命中旧值
+	if view, err := g.Get("Tom"); err != nil || view.String() != "1" {
+		t.Fatalf("expect the old value during refresh, but got %q, %v", view.String(), err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "2" {
+		t.Fatalf("expect the refreshed value 2, but got %q, %v", view.String(), err)
+	}
+	if stats := g.Stats(); stats.Loads != 2 || stats.LocalHits != 2 {
+		t.Fatalf("expect no miss during refresh, but got %+v", stats)
+	}
+}
+
+func TestGetFresh(t *testing.T) {
+	scores := map[string]string{"Tom": "630"}
+	g := NewGroup("get-fresh", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(scores[key]), nil
+	}))
+	g.Get("Tom")
+	scores["Tom"] = "631"
+	if view, _ := g.Get("Tom"); view.String() != "630" {
+		t.Fatalf("expect the cached value 630, but got %q", view.String())
+	}
+	if view, err := g.GetFresh("Tom"); err != nil || view.String() != "631" {
+		t.Fatalf("expect the fresh value 631, but got %q, %v", view.String(), err)
+	}
+	if view, ok := g.mainCache.get("Tom"); !ok || view.String() != "631" {
+		t.Fatalf("GetFresh should update the cache, but got %q", view.String())
+	}
+}
+
+func TestGetterRateLimit(t *testing.T) {
+	const rps, burst, n = 200, 10, 100
+	var calls int64
+	g := NewGroup("rate-limit", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt64(&calls, 1)
+		return []byte(key), nil
+	}))
+	g.SetGetterRateLimit(rps, burst)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := g.Get(key); err != nil {
+				t.Error(err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	// 令牌桶最多允许 burst + rps * elapsed 次调用
+	if limit := burst + int64(rps*elapsed.Seconds()) + 1; atomic.LoadInt64(&calls) != n || n > limit {
+		t.Fatalf("%d getter calls in %v exceed the rate limit of %d", calls, elapsed, limit)
+	}
+	if min := time.Duration(n-burst) * time.Second / rps; elapsed < min*9/10 {
+		t.Fatalf("expect the misses to be throttled for about %v, but took %v", min, elapsed)
+	}
+
+	// 等待令牌时 ctx 被取消，立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	g.SetGetterRateLimit(1, 1)
+	g.Get("first")
+	if _, err := g.GetContext(ctx, "second"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, but got %v", err)
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	const limit, n = 5, 50
+	var running, peak int64
+	g := NewGroup("max-loads", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		cur := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+		for {
+			old := atomic.LoadInt64(&peak)
+			if cur <= old || atomic.CompareAndSwapInt64(&peak, old, cur) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return []byte(key), nil
+	}))
+	g.SetMaxConcurrentLoads(limit)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := g.Get(key); err != nil {
+				t.Error(err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	if p := atomic.LoadInt64(&peak); p > limit || p == 0 {
+		t.Fatalf("expect at most %d concurrent loads, but got %d", limit, p)
+	}
+	if loads := g.Stats().Loads; loads != n {
+		t.Fatalf("expect %d loads, but got %d", n, loads)
+	}
+
+	// 排队期间 ctx 被取消，立即返回
+	block := make(chan struct{})
+	blocked := NewGroup("max-loads-cancel", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-block
+		return []byte(key), nil
+	}))
+	blocked.SetMaxConcurrentLoads(1)
+	go blocked.Get("first")
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := blocked.GetContext(ctx, "second"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded while queueing, but got %v", err)
+	}
+	close(block)
+}
+
+func TestDelete(t *testing.T) {
+	loadCounts := make(map[string]int, len(db))
+	g := NewGroup("delete", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key] += 1
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatal("failed to get value of Tom")
+	}
+	if err := g.Delete("Tom"); err != nil {
+		t.Fatalf("failed to delete Tom: %v", err)
+	}
+	// 删除后再次读取，需要重新从数据源加载
+	if view, err := g.Get("Tom"); err != nil || view.String() != db["Tom"] || loadCounts["Tom"] != 2 {
+		t.Fatalf("Tom should be reloaded after delete")
+	}
+	// 删除不存在的 key 是一个空操作
+	if err := g.Delete("unknown"); err != nil {
+		t.Fatalf("delete unknown key should be a no-op, but got %v", err)
+	}
+}
+
+func TestGetContextCancel(t *testing.T) {
+	g := NewGroup("context", 2<<10, GetterContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			// 模拟一个很慢的数据源，只有 ctx 被取消时才会返回
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "Tom"); err != context.DeadlineExceeded {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("cancelled load should not populate cache")
+	}
+}
+
+func TestGetContextCancelShared(t *testing.T) {
+	var loads int64
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("context-shared", 2<<10, GetterContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			atomic.AddInt64(&loads, 1)
+			close(entered)
+			select {
+			case <-release:
+				return []byte("630"), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+
+	// 发起加载的调用方取消后立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctx, "Tom")
+		leader <- err
+	}()
+	<-entered
+	follower := make(chan ByteView, 1)
+	go func() {
+		view, _ := g.Get("Tom")
+		follower <- view
+	}()
+	time.Sleep(10 * time.Millisecond) // 等待 follower 加入进行中的加载
+	cancel()
+	select {
+	case err := <-leader:
+		if err != context.Canceled {
+			t.Fatalf("expect %v, but got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("cancelled caller should return without waiting for the load")
+	}
+
+	// 加载继续进行，其他调用方仍然拿到结果，且结果被写回缓存
+	close(release)
+	if view := <-follower; view.String() != "630" {
+		t.Fatalf("expect the shared load to complete, but got %q", view.String())
+	}
+	if _, ok := g.mainCache.get("Tom"); !ok || atomic.LoadInt64(&loads) != 1 {
+		t.Fatalf("expect one load to populate the cache, but got %d loads", loads)
+	}
+}
+
+func TestGetContextCancelAll(t *testing.T) {
+	entered := make(chan struct{})
+	cancelled := make(chan error, 1)
+	g := NewGroup("context-cancel-all", 2<<10, GetterContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			close(entered)
+			<-ctx.Done() // 只在 ctx 被取消时返回的回调函数
+			cancelled <- ctx.Err()
+			return nil, ctx.Err()
+		}))
+
+	// 唯一的调用方取消后（例如客户端断开连接，没有截止时间），回调函数的 ctx 同样被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-entered
+		cancel()
+	}()
+	if _, err := g.GetContext(ctx, "Tom"); err != context.Canceled {
+		t.Fatalf("expect %v, but got %v", context.Canceled, err)
+	}
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Fatalf("expect the getter to see %v, but got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("getter should be cancelled after every caller has left")
+	}
+}
+
+// fakePeer 同时实现了 PeerPicker 和 PeerGetter，除 local 中的 key 外都会被路由到 fakePeer，用于测试与远程节点交互的逻辑
+type fakePeer struct {
+	sets      map[string][]byte
+	local     map[string]bool
+	gets      int             // Get 被调用的次数
+	multiKeys []string        // GetMulti 请求的所有 key
+	corrupt   map[string]bool // GetMulti 返回的值在计算校验和之后被篡改的 key
+}
+
+func (p *fakePeer) PickPeer(key string) (PeerGetter, bool) {
+	if p.local[key] {
+		return nil, false
+	}
+	return p, true
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	if v, ok := p.sets[in.Key]; ok {
+		out.Value = v
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, in.Key)
+}
+
+func (p *fakePeer) Delete(ctx context.Context, in *pb.Request) error {
+	delete(p.sets, in.Key)
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.Request) error {
+	p.sets[in.Key] = in.Value
+	return nil
+}
+
+func (p *fakePeer) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	out.Values = make(map[string][]byte)
+	out.Errors = make(map[string]string)
+	out.Versions = make(map[string]int64)
+	out.Checksums = make(map[string]uint32)
+	p.multiKeys = append(p.multiKeys, in.Keys...)
+	for i, key := range in.Keys {
+		if v, ok := p.sets[key]; ok {
+			out.Values[key] = v
+			out.Versions[key] = int64(i + 1)
+			out.Checksums[key] = crc32.ChecksumIEEE(v)
+			if p.corrupt[key] {
+				out.Values[key] = append([]byte("x"), v...)
+			}
+		} else {
+			out.Errors[key] = key + " not exist"
+		}
+	}
+	return nil
+}
+
+func (p *fakePeer) Has(ctx context.Context, in *pb.Request) (bool, error) {
+	_, ok := p.sets[in.Key]
+	return ok, nil
+}
+
+func (p *fakePeer) Clear(ctx context.Context, in *pb.Request) error {
+	p.sets = make(map[string][]byte)
+	return nil
+}
+
+func (p *fakePeer) DeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	n := 0
+	for key := range p.sets {
+		if strings.HasPrefix(key, in.Key) {
+			delete(p.sets, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestSet(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+
+	// 没有远程节点时，直接写入本地缓存
+	g := NewGroup("set", 2<<10, getter)
+	if err := g.Set("Tom", []byte("630")); err != nil {
+		t.Fatalf("failed to set Tom: %v", err)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("failed to get value of Tom after set")
+	}
+
+	// key 归属于远程节点时，写入请求被转发到该节点，而不写入本地缓存
+	peer := &fakePeer{sets: make(map[string][]byte)}
+	remote := NewGroup("set-remote", 2<<10, getter)
+	remote.RegisterPeers(peer)
+	if err := remote.Set("Jack", []byte("589")); err != nil {
+		t.Fatalf("failed to set Jack: %v", err)
+	}
+	if string(peer.sets["Jack"]) != "589" {
+		t.Fatalf("set should be forwarded to the owning peer")
+	}
+	if _, ok := remote.mainCache.get("Jack"); ok {
+		t.Fatalf("set of a remote key should not populate local cache")
+	}
+}
+
+func TestL1(t *testing.T) {
+	peer := &fakePeer{sets: map[string][]byte{"Tom": []byte("630")}}
+	g := NewGroup("l1", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.RegisterPeers(peer)
+	g.EnableL1(1<<10, 50*time.Millisecond)
+
+	// 第二次读取命中 L1，不再访问远程节点
+	for i := 0; i < 2; i++ {
+		if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("failed to get Tom: %q, %v", view.String(), err)
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("expect the second read to hit L1, but the peer was called %d times", peer.gets)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("remote keys should not populate main cache")
+	}
+
+	// Delete 使 L1 失效
+	g.Delete("Tom")
+	peer.sets["Tom"] = []byte("631")
+	if view, _ := g.Get("Tom"); view.String() != "631" || peer.gets != 2 {
+		t.Fatalf("expect Delete to invalidate L1, but got %q after %d peer calls", view.String(), peer.gets)
+	}
+
+	// 过期后重新从远程节点获取
+	time.Sleep(60 * time.Millisecond)
+	g.Get("Tom")
+	if peer.gets != 3 {
+		t.Fatalf("expect the L1 entry to expire, but the peer was called %d times", peer.gets)
+	}
+}
+
+func TestHotKeyReplication(t *testing.T) {
+	peer := &fakePeer{sets: map[string][]byte{"Tom": []byte("630"), "Jack": []byte("589")}}
+	g := NewGroup("hotkey", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.RegisterPeers(peer)
+	g.SetHotKeyReplication(3, time.Minute)
+
+	// 访问次数未达到阈值前每次读取都访问归属节点
+	for i := 0; i < 3; i++ {
+		if view, source, err := g.GetWithSource("Tom"); err != nil || view.String() != "630" || source != SourcePeer {
+			t.Fatalf("failed to get Tom from peer: %q, %v, %v", view.String(), source, err)
+		}
+	}
+	// 达到阈值后由本节点的副本返回
+	for i := 0; i < 5; i++ {
+		if view, source, err := g.GetWithSource("Tom"); err != nil || view.String() != "630" || source != SourceLocalCache {
+			t.Fatalf("expect hot key Tom to be served locally, but got %q, %v, %v", view.String(), source, err)
+		}
+	}
+	if peer.gets != 3 {
+		t.Fatalf("expect the peer to be called 3 times, but got %d", peer.gets)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("hot replicas should not populate main cache")
+	}
+
+	// 不热的 key 不会被复制
+	g.Get("Jack")
+	g.Get("Jack")
+	if peer.gets != 5 {
+		t.Fatalf("expect cold key Jack to be read from peer, but the peer was called %d times", peer.gets)
+	}
+
+	// Delete 删除副本
+	g.Delete("Tom")
+	peer.sets["Tom"] = []byte("631")
+	if view, _ := g.Get("Tom"); view.String() != "631" || peer.gets != 6 {
+		t.Fatalf("expect Delete to drop the replica, but got %q after %d peer calls", view.String(), peer.gets)
+	}
+}
+
+func TestHas(t *testing.T) {
+	var loads int
+	g := NewGroup("has", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.SetNegativeCacheTTL(time.Minute)
+	g.Get("Tom")
+	g.Get("unknown")
+	if !g.Has("Tom") {
+		t.Fatalf("expect Has to report the cached key Tom")
+	}
+	// 未缓存的 key 不会被加载，缓存的 ErrNotFound 视为不存在
+	if g.Has("Jack") || g.Has("unknown") || g.Has("") {
+		t.Fatalf("expect Has to report uncached keys as missing")
+	}
+	if _, ok := g.mainCache.get("Jack"); ok || loads != 2 {
+		t.Fatalf("Has should not load the key, loads = %d", loads)
+	}
+
+	// key 归属于远程节点时，向该节点查询
+	peer := &fakePeer{sets: map[string][]byte{"Sam": []byte("567")}}
+	remote := NewGroup("has-remote", 2<<10, g.getter)
+	remote.RegisterPeers(peer)
+	if !remote.Has("Sam") || remote.Has("Tom") || peer.gets != 0 {
+		t.Fatalf("expect Has to probe the peer without getting the value")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persist.db")
+	g := NewGroup("persist", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if err := g.EnablePersistence(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for key := range db {
+		g.Get(key)
+	}
+	if err := g.Snapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	// 快照之后的写入与删除追加在快照之后
+	g.Set("Rose", []byte("601"))
+	g.Delete("Sam")
+	if err := g.ClosePersistence(); err != nil {
+		t.Fatalf("failed to close persistence: %v", err)
+	}
+
+	var loads int
+	fresh := NewGroup("persist-fresh", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if err := fresh.LoadSnapshot(path); err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	for key, v := range map[string]string{"Tom": "630", "Jack": "589", "Rose": "601"} {
+		if view, err := fresh.Get(key); err != nil || view.String() != v {
+			t.Fatalf("expect %s=%s from snapshot, but got %q, %v", key, v, view.String(), err)
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("expect all keys to hit the loaded cache, but the getter was called %d times", loads)
+	}
+	if fresh.hasLocally("Sam") {
+		t.Fatalf("deleted key Sam should not be loaded")
+	}
+}
+
+func TestPersistenceOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order.db")
+	g := NewGroup("persist-order", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if err := g.EnablePersistence(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 并发的写入与删除，持久化的记录顺序与缓存的修改顺序一致
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		key := strconv.Itoa(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			g.Set(key, []byte(key))
+		}()
+		go func() {
+			defer wg.Done()
+			g.Delete(key)
+		}()
+	}
+	wg.Wait()
+	if err := g.ClosePersistence(); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := NewGroup("persist-order-fresh", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if err := fresh.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		key := strconv.Itoa(i)
+		if g.hasLocally(key) != fresh.hasLocally(key) {
+			t.Fatalf("expect %s to be cached %v after reload, as before", key, g.hasLocally(key))
+		}
+	}
+}
+
+func TestReenablePersistence(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGroup("persist-reenable", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	if err := g.EnablePersistence(filepath.Join(dir, "a.db"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.ClosePersistence(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Snapshot(); err == nil || err.Error() != "persistence is not enabled" {
+		t.Fatalf("expect persistence not enabled after close, but got %v", err)
+	}
+	// 关闭之后可以重新启用持久化
+	path := filepath.Join(dir, "b.db")
+	if err := g.EnablePersistence(path, 0); err != nil {
+		t.Fatalf("failed to re-enable persistence: %v", err)
+	}
+	g.Set("Tom", []byte("630"))
+	if err := g.ClosePersistence(); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewGroup("persist-reenable-fresh", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	if err := fresh.LoadSnapshot(path); err != nil || !fresh.hasLocally("Tom") {
+		t.Fatalf("expect Tom to be persisted after re-enabling, but got %v", err)
+	}
+}
+
+func TestContains(t *testing.T) {
+	var loads int
+	g := NewGroup("contains", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}))
+	if g.Contains("Tom") || g.Len() != 0 || loads != 0 {
+		t.Fatalf("expect Tom in the DB not to be cached before loading")
+	}
+	g.Get("Tom")
+	g.Get("Jack")
+	if !g.Contains("Tom") || g.Contains("Sam") || g.Len() != 2 || loads != 2 {
+		t.Fatalf("expect Contains and Len to inspect the cache without loading, got len %d, %d loads", g.Len(), loads)
+	}
+	// Contains 不会更新访问记录
+	g.Contains("Tom")
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"Tom", "Jack"}) {
+		t.Fatalf("Contains should not promote Tom, but got %v", keys)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	g := NewGroup("version", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	// 无论到达顺序如何，版本较新的写入都会保留下来
+	g.populateCache("Tom", ByteView{b: []byte("new"), version: 2})
+	g.populateCache("Tom", ByteView{b: []byte("old"), version: 1})
+	g.populateCache("Jack", ByteView{b: []byte("old"), version: 1})
+	g.populateCache("Jack", ByteView{b: []byte("new"), version: 2})
+	for _, key := range []string{"Tom", "Jack"} {
+		if view, err := g.Get(key); err != nil || view.String() != "new" {
+			t.Fatalf("expect the newer write of %s to persist, but got %q, %v", key, view.String(), err)
+		}
+	}
+}
+
+func TestSetDuringLoad(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("set-during-load", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		close(loading)
+		<-release
+		return []byte("stale"), nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = g.Get("Tom")
+	}()
+	<-loading
+	// 加载开始后写入的新值，版本比加载到的旧数据更新
+	if err := g.Set("Tom", []byte("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-done
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "fresh" {
+		t.Fatalf("stale load should not overwrite a newer Set, but got %q, %v", view.String(), err)
+	}
+}
+
+func TestShardedGroup(t *testing.T) {
+	loadCounts := make(map[string]int)
+	g := NewGroupSharded("sharded", 2<<10, 4, GetterFunc(func(key string) ([]byte, error) {
+		loadCounts[key] += 1
+		return []byte(db[key]), nil
+	}))
+	for i := 0; i < 2; i++ {
+		for k, v := range db {
+			if view, err := g.Get(k); err != nil || view.String() != v || loadCounts[k] != 1 {
+				t.Fatalf("failed to get %s from sharded cache", k)
+			}
+		}
+	}
+	if len(g.Keys()) != len(db) {
+		t.Fatalf("expect %d keys, but got %v", len(db), g.Keys())
+	}
+	if err := g.Delete("Tom"); err != nil || len(g.Keys()) != len(db)-1 {
+		t.Fatalf("failed to delete Tom from sharded cache: %v", err)
+	}
+	g.Clear()
+	if g.CacheBytes() != 0 {
+		t.Fatalf("sharded cache should be empty after Clear")
+	}
+}
+
+func TestShardedGroupWithPolicy(t *testing.T) {
+	var created int
+	newLFU := func(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy {
+		created++
+		return lfu.New(maxBytes, 0, onEvicted)
+	}
+	g := NewGroupShardedWithPolicy("sharded-lfu", 2<<10, 4, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), newLFU)
+	// 注册时分片已经创建完成
+	if GetGroup("sharded-lfu") != g || len(g.mainCache.shards) != 4 {
+		t.Fatalf("expect the registered group to be fully sharded")
+	}
+	for i := 0; i < 100; i++ {
+		_, _ = g.Get(strconv.Itoa(i))
+	}
+	if created != 4 {
+		t.Fatalf("expect each of the 4 shards to use the LFU policy, but %d were created", created)
+	}
+}
+
+// 对比单锁与分片缓存在并发读取下的吞吐量：
+//
+//	go test -bench=GetParallel -cpu=8 ./dcache
+func benchmarkGetParallel(b *testing.B, g *Group) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		_, _ = g.Get(keys[i])
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = g.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func TestGetBytes(t *testing.T) {
+	g := NewGroup("get-bytes", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat(key, 100)), nil
+	}))
+	g.SetCompression(64)
+	for _, key := range []string{"Tom", "x"} {
+		b, err := g.GetBytes(key)
+		if err != nil || string(b) != strings.Repeat(key, 100) {
+			t.Fatalf("failed to get bytes of %s: %v", key, err)
+		}
+		// 修改返回的切片不会影响缓存中的值
+		b[0] = '!'
+		if view, _ := g.Get(key); view.String() != strings.Repeat(key, 100) {
+			t.Fatalf("GetBytes should return a copy, but the cached value of %s was modified", key)
+		}
+	}
+}
+
+// benchSink 保存基准测试的结果，避免编译器把未被使用的拷贝优化掉
+var benchSink []byte
+
+// benchmarkGet 分别获取未压缩与压缩后缓存的值。ByteView 按值返回，本身不会分配内存，
+// 两种方式的差别在于压缩的值：GetBytes 直接返回解压得到的切片，Get().ByteSlice() 还需要再拷贝一次
+func benchmarkGet(b *testing.B, get func(g *Group) error) {
+	for _, c := range []struct {
+		name  string
+		value []byte
+	}{
+		{"plain", []byte("630")},
+		{"compressed", bytes.Repeat([]byte("630"), 1000)},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			g := NewGroup("bench-get-bytes", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+				return c.value, nil
+			}))
+			g.SetCompression(1024)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := get(g); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetByteSlice(b *testing.B) {
+	benchmarkGet(b, func(g *Group) error {
+		view, err := g.Get("Tom")
+		benchSink = view.ByteSlice()
+		return err
+	})
+}
+
+func BenchmarkGetBytes(b *testing.B) {
+	benchmarkGet(b, func(g *Group) error {
+		var err error
+		benchSink, err = g.GetBytes("Tom")
+		return err
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	benchmarkGetParallel(b, NewGroup("bench-single", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})))
+}
+
+func BenchmarkGetParallelSharded(b *testing.B) {
+	benchmarkGetParallel(b, NewGroupSharded("bench-sharded", 1<<20, 16, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})))
+}
+
+// BenchmarkCacheReadHeavy 比较 95% 命中的并发读写下，命中持有互斥锁与只持有读锁的吞吐量
+func BenchmarkCacheReadHeavy(b *testing.B) {
+	for _, readOptimized := range []bool{false, true} {
+		name := "mutex"
+		if readOptimized {
+			name = "read-optimized"
+		}
+		b.Run(name, func(b *testing.B) {
+			c := &cache{cacheBytes: 1 << 20}
+			c.setReadOptimized(readOptimized)
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				c.add(keys[i], ByteView{b: []byte(keys[i])})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(keys))
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%20 == 0 {
+						c.add(key, ByteView{b: []byte(key)})
+					} else {
+						c.get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestReadOptimized(t *testing.T) {
+	// 每条记录占用 8 字节，缓存最多容纳 2 条记录
+	g := NewGroup("read-optimized", 16, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.SetReadOptimized(true)
+	g.Get("key1")
+	g.Get("key2")
+	// 命中只持有读锁，访问记录在下一次写入时补上，key1 成为最近访问的记录
+	if view, err := g.Get("key1"); err != nil || view.String() != "key1" {
+		t.Fatalf("expect a hit for key1, but got %q, %v", view.String(), err)
+	}
+	g.Get("key3")
+	if !g.Contains("key1") || g.Contains("key2") {
+		t.Fatalf("expect key2 to be evicted as the least recently used, but got keys %v", g.Keys())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := "key" + strconv.Itoa((i+j)%4)
+				if view, err := g.Get(key); err != nil || view.String() != key {
+					t.Errorf("expect %s, but got %q, %v", key, view.String(), err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLFUPolicy(t *testing.T) {
+	newLFU := func(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy {
+		return lfu.New(maxBytes, 0, onEvicted)
+	}
+	loadCounts := make(map[string]int)
+	// 每条记录占用 6 字节，缓存最多容纳 2 条记录
+	g := NewGroupWithPolicy("lfu", 12, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key] += 1
+			return []byte(key), nil
+		}), newLFU)
+
+	for i := 0; i < 5; i++ {
+		_, _ = g.Get("hot")
+	}
+	// 大量只访问一次的 key 不会把热点 key 挤出缓存
+	for i := 0; i < 10; i++ {
+		_, _ = g.Get(fmt.Sprintf("k%02d", i))
+	}
+	if _, err := g.Get("hot"); err != nil || loadCounts["hot"] != 1 {
+		t.Fatalf("frequently accessed key should survive eviction under LFU")
+	}
+	if _, ok := g.mainCache.get("k00"); ok {
+		t.Fatalf("rarely used key should be evicted under LFU")
+	}
+}
+
+// lazyPolicy 在 Keys 与 Len 中淘汰最旧的记录，模拟惰性删除过期记录的淘汰策略
+type lazyPolicy struct {
+	Policy
+}
+
+func (p lazyPolicy) Keys() []string {
+	p.RemoveOldest()
+	return p.Policy.Keys()
+}
+
+func (p lazyPolicy) Len() int {
+	p.RemoveOldest()
+	return p.Policy.Len()
+}
+
+func TestEvictedDuringKeys(t *testing.T) {
+	g := NewGroupWithPolicy("evicted-during-keys", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), func(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy {
+		return lazyPolicy{LRUPolicy(maxBytes, onEvicted)}
+	})
+	var evicted []string
+	g.mainCache.setOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		evicted = append(evicted, key)
+	})
+	for _, key := range []string{"k1", "k2", "k3"} {
+		_, _ = g.Get(key)
+	}
+	// Keys 与 Len 中被删除的记录在释放锁时立即回调，而不是等到之后无关的调用
+	g.Keys()
+	if !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect OnEvicted for k1 during Keys, but got %v", evicted)
+	}
+	g.Len()
+	if !reflect.DeepEqual(evicted, []string{"k1", "k2"}) {
+		t.Fatalf("expect OnEvicted for k2 during Len, but got %v", evicted)
+	}
+}
+
+func TestTwoQueuePolicy(t *testing.T) {
+	newTwoQ := func(maxBytes int64, onEvicted func(key string, value lru.Value, reason lru.EvictReason)) Policy {
+		return twoq.New(maxBytes, 0, onEvicted)
+	}
+	loadCounts := make(map[string]int)
+	// 每条记录占用 6 字节，缓存最多容纳 8 条记录
+	g := NewGroupWithPolicy("twoq", 48, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key] += 1
+			return []byte(key), nil
+		}), newTwoQ)
+
+	_, _ = g.Get("hot")
+	_, _ = g.Get("hot")
+	// 扫描只访问一次的 key 不会把热点 key 挤出缓存
+	for i := 0; i < 20; i++ {
+		_, _ = g.Get(fmt.Sprintf("k%02d", i))
+	}
+	if _, err := g.Get("hot"); err != nil || loadCounts["hot"] != 1 {
+		t.Fatalf("hot key should survive the scan under 2Q")
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	g := NewGroup("get-into", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	if s, err := g.GetString("Tom"); err != nil || s != "630" {
+		t.Fatalf("expect 630, but got %q, %v", s, err)
+	}
+
+	buf := make([]byte, 8)
+	if n, err := g.GetInto("Tom", buf); err != nil || n != 3 || string(buf[:n]) != "630" {
+		t.Fatalf("expect 630, but got %q, %v", buf[:n], err)
+	}
+	// 缓冲区不足时截断，并返回完整的长度
+	short := make([]byte, 2)
+	n, err := g.GetInto("Tom", short)
+	if !errors.Is(err, io.ErrShortBuffer) || n != 3 || string(short) != "63" {
+		t.Fatalf("expect truncated 63 and length 3, but got %q, %d, %v", short, n, err)
+	}
+	if _, err := g.GetInto("", buf); err == nil {
+		t.Fatalf("expect error for empty key")
+	}
+}
+
+func TestGetWithSource(t *testing.T) {
+	g := NewGroup("source", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.RegisterPeers(&fakePeer{
+		sets:  map[string][]byte{"Jack": []byte("589")},
+		local: map[string]bool{"Tom": true},
+	})
+	testcases := []struct {
+		key    string
+		source Source
+	}{
+		{"Tom", SourceGetter},
+		{"Tom", SourceLocalCache},
+		{"Jack", SourcePeer},
+		{"Jack", SourcePeer}, // 从远程节点获取的值不会写入本地缓存
+	}
+	for _, tc := range testcases {
+		view, source, err := g.GetWithSource(tc.key)
+		if err != nil || view.String() != db[tc.key] || source != tc.source {
+			t.Fatalf("expect %s from %v, but got %q from %v, %v", tc.key, tc.source, view.String(), source, err)
+		}
+	}
+}
+
+func TestGetOrCompute(t *testing.T) {
+	g := NewGroup("compute", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	var computes int64
+	release := make(chan struct{})
+	compute := func() ([]byte, error) {
+		atomic.AddInt64(&computes, 1)
+		<-release
+		return []byte("630"), nil
+	}
+
+	// 并发的调用方只会执行一次 compute
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if view, err := g.GetOrCompute("Tom", compute); err != nil || view.String() != "630" {
+				t.Errorf("failed to compute Tom: %q, %v", view.String(), err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt64(&computes); n != 1 {
+		t.Fatalf("expect compute to run once, but got %d", n)
+	}
+
+	// 计算结果被写入缓存，之后的 Get 与 GetOrCompute 直接命中
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect the computed value to be cached, but got %q, %v", view.String(), err)
+	}
+	g.GetOrCompute("Tom", compute)
+	if n := atomic.LoadInt64(&computes); n != 1 {
+		t.Fatalf("expect a cache hit, but compute ran %d times", n)
+	}
+
+	// compute 返回错误时不写入缓存
+	if _, err := g.GetOrCompute("Jack", func() ([]byte, error) {
+		return nil, errors.New("compute failed")
+	}); err == nil || g.Contains("Jack") {
+		t.Fatalf("failed compute should return the error without caching, but got %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	g := NewGroup("tags", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.SetWithTags("user:5", []byte("Tom"), []string{"user:5", "org:3"})
+	g.SetWithTags("user:6", []byte("Jack"), []string{"user:6", "org:3"})
+	g.SetWithTags("user:7", []byte("Sam"), []string{"user:7", "org:4"})
+	g.Set("config", []byte("1"))
+
+	if n := g.InvalidateTag("org:3"); n != 2 {
+		t.Fatalf("expect 2 keys tagged org:3 to be removed, but got %d", n)
+	}
+	if expect := []string{"user:7", "config"}; !reflect.DeepEqual(expect, g.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", g.Keys(), expect)
+	}
+	if n := g.InvalidateTag("org:3"); n != 0 {
+		t.Fatalf("expect the tag to be gone after invalidation, but removed %d keys", n)
+	}
+
+	// 重新打标签会替换已有的标签
+	g.SetWithTags("user:7", []byte("Sam"), []string{"org:5"})
+	if n := g.InvalidateTag("org:4"); n != 0 || !g.Contains("user:7") {
+		t.Fatalf("expect retagged user:7 to be kept, but removed %d keys", n)
+	}
+
+	// 被删除的 key 同时从索引中删除
+	g.Delete("user:7")
+	if keys := g.tags.keysOf("org:5"); len(keys) != 0 {
+		t.Fatalf("expect Delete to clean up the tag index, but got %v", keys)
+	}
+}
+
+func TestTagsEviction(t *testing.T) {
+	g := NewGroup("tags-eviction", 12, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.SetWithTags("k1", []byte("123456"), []string{"t"})
+	g.SetWithTags("k2", []byte("123456"), []string{"t"})
+	// 容量不足淘汰 k1，k1 同时从索引中删除
+	if keys := g.tags.keysOf("t"); !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("expect the evicted key to leave the tag index, but got %v", keys)
+	}
+}
+
+func TestTagsStaleWrite(t *testing.T) {
+	g := NewGroup("tags-stale", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	// 缓存中已有一个版本更新、没有标签的值
+	g.populateCache("k", ByteView{b: []byte("newer"), version: newVersion() + int64(time.Hour)})
+	if err := g.SetWithTags("k", []byte("older"), []string{"t"}); err != nil {
+		t.Fatal(err)
+	}
+	// 被拒绝的写入不记录标签，InvalidateTag 不会删除更新的值
+	if n := g.InvalidateTag("t"); n != 0 {
+		t.Fatalf("expect no key tagged by a rejected write, but invalidated %d", n)
+	}
+	if view, ok := g.mainCache.get("k"); !ok || view.String() != "newer" {
+		t.Fatalf("expect the newer value to stay cached, but got %q", view.String())
+	}
+}
+
+func TestGetWithMeta(t *testing.T) {
+	g := NewGroup("meta", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	_, meta, err := g.GetWithMeta("Tom")
+	if err != nil || meta.Source != SourceGetter || meta.TTL != 0 {
+		t.Fatalf("expect Tom from getter without TTL, but got %+v, %v", meta, err)
+	}
+	_, cached, _ := g.GetWithMeta("Tom")
+	if cached.Source != SourceLocalCache || cached.Hash != meta.Hash || len(meta.Hash) != 64 {
+		t.Fatalf("expect the same hash for the cached value, but got %+v and %+v", meta, cached)
+	}
+	if _, other, _ := g.GetWithMeta("Jack"); other.Hash == meta.Hash {
+		t.Fatalf("expect different values to have different hashes")
+	}
+
+	g.SetStaleWhileRevalidate(time.Minute, time.Minute)
+	g.Delete("Tom")
+	if _, meta, _ = g.GetWithMeta("Tom"); meta.TTL <= 0 || meta.TTL > time.Minute {
+		t.Fatalf("expect the remaining TTL within a minute, but got %v", meta.TTL)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	g := NewGroup("multi", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	g.RegisterPeers(&fakePeer{
+		sets:  map[string][]byte{"Jack": []byte("589")},
+		local: map[string]bool{"Tom": true, "Sam": true},
+	})
+
+	values, err := g.GetMulti([]string{"Tom", "Jack", "Sam", "unknown"})
+	for _, k := range []string{"Tom", "Jack", "Sam"} {
+		if view, ok := values[k]; !ok || view.String() != db[k] {
+			t.Fatalf("failed to get value of %s", k)
+		}
+	}
+	failed, ok := err.(MultiError)
+	if !ok || len(failed) != 1 || failed["unknown"] == nil {
+		t.Fatalf("expect unknown to be reported as failed, but got %v", err)
+	}
+}
+
+func TestGetMultiPeerValues(t *testing.T) {
+	peer := &fakePeer{
+		sets:    map[string][]byte{"Tom": []byte("630"), "Jack": []byte("589")},
+		corrupt: map[string]bool{"Jack": true},
+	}
+	g := NewGroup("multi-peer-values", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	g.RegisterPeers(peer)
+
+	// 重复的 key 只请求一次
+	values, err := g.GetMulti([]string{"Tom", "Tom", "Jack", "Tom"})
+	if expect := []string{"Tom", "Jack"}; !reflect.DeepEqual(peer.multiKeys, expect) {
+		t.Fatalf("expect peer to be asked for %v, but got %v", expect, peer.multiKeys)
+	}
+	// 远程节点返回的版本号被保留，校验失败的值不会被使用
+	if v, ok := values["Tom"]; !ok || v.String() != "630" || v.version != 1 {
+		t.Fatalf("expect Tom=630 with version 1, but got %q, version %d", v.String(), v.version)
+	}
+	failed, ok := err.(MultiError)
+	if !ok || len(failed) != 1 || !errors.Is(failed["Jack"], ErrChecksumMismatch) {
+		t.Fatalf("expect a checksum mismatch for Jack, but got %v", err)
+	}
+}
+
+func TestGetMultiNotFound(t *testing.T) {
+	broken := errors.New("db timeout")
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if key == "broken" {
+			return nil, broken
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	})
+	a := NewGroup("multi-not-found-a", 2<<10, getter)
+	b := NewGroup("multi-not-found-b", 2<<10, getter)
+	getterB := NewLocalGetter()
+	getterB.AddGroup("multi-not-found-a", b)
+	pool := NewLocalPool("a")
+	pool.Add("b", getterB) // 本节点不在哈希环上，所有 key 都由 b 负责
+	a.RegisterPeers(pool)
+
+	// 远程节点上不存在的 key 与本节点上的一样满足 errors.Is(err, ErrNotFound)
+	_, err := a.GetMulti([]string{"missing", "broken"})
+	failed, ok := err.(MultiError)
+	if !ok || len(failed) != 2 {
+		t.Fatalf("expect 2 failed keys, but got %v", err)
+	}
+	if !errors.Is(failed["missing"], ErrNotFound) {
+		t.Fatalf("expect ErrNotFound for a missing remote key, but got %v", failed["missing"])
+	}
+	if errors.Is(failed["broken"], ErrNotFound) {
+		t.Fatalf("a failed remote key should not be reported as ErrNotFound: %v", failed["broken"])
+	}
+
+	a.SetDefaultValue([]byte("default"))
+	values, err := a.GetMulti([]string{"missing"})
+	if err != nil || values["missing"].String() != "default" {
+		t.Fatalf("expect the default value for a missing remote key, but got %v, %v", values, err)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	value := []byte(strings.Repeat(`{"name":"Tom","score":630},`, 400)) // 约 10KB 的 JSON
+	g := NewGroup("compression", 2<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return value, nil
+		}))
+	g.SetCompression(1024)
+
+	if view, err := g.Get("Tom"); err != nil || !bytes.Equal(view.ByteSlice(), value) {
+		t.Fatalf("failed to get the original value back: %v", err)
+	}
+	stored, ok := g.mainCache.get("Tom")
+	if !ok || !stored.compressed || stored.Len() >= len(value) {
+		t.Fatalf("large value should be stored compressed")
+	}
+	if view, err := g.Get("Tom"); err != nil || !bytes.Equal(view.ByteSlice(), value) {
+		t.Fatalf("failed to decompress the cached value: %v", err)
+	}
+
+	// 小于阈值的缓存值不压缩
+	_ = g.Set("Jack", []byte("589"))
+	if stored, _ := g.mainCache.get("Jack"); stored.compressed {
+		t.Fatalf("small value should not be compressed")
+	}
+}
+
+func TestDeleteDuringLoad(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("delete-during-load", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			close(entered)
+			<-release // 模拟一个很慢的数据源
+			return []byte("stale"), nil
+		}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = g.Get("Tom")
+	}()
+	<-entered
+	if err := g.Delete("Tom"); err != nil {
+		t.Fatalf("failed to delete Tom: %v", err)
+	}
+	close(release)
+	<-done
+
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("in-flight load should not write back a deleted key")
+	}
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	var mu sync.Mutex
+	var failing error
+	setFailing := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failing = err
+	}
+	g := NewGroup("stale-on-error", 2<<10, GetterWithTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing != nil {
+			return nil, 0, failing
+		}
+		return []byte("good " + key), 20 * time.Millisecond, nil
+	}))
+	g.SetServeStaleOnError(true)
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "good Tom" || view.Stale() {
+		t.Fatalf("expect a fresh value, but got %q, %v", view.String(), err)
+	}
+	setFailing(errors.New("db is down"))
+	time.Sleep(30 * time.Millisecond)
+
+	// 数据源不可用时返回最后一次获取成功的值
+	view, source, err := g.GetWithSource("Tom")
+	if err != nil || view.String() != "good Tom" || !view.Stale() || source != SourceLocalCache {
+		t.Fatalf("expect the last good value to be served stale, but got %q from %v, %v", view.String(), source, err)
+	}
+	if g.Contains("Tom") {
+		t.Fatalf("expect an expired value not to be reported as cached")
+	}
+	// 从未获取成功的 key 仍然返回错误
+	if _, err := g.Get("Jack"); err == nil {
+		t.Fatalf("expect an error for a key without a cached value")
+	}
+	// ErrNotFound 说明数据已不存在，不返回过期的值
+	setFailing(notFoundError("Tom"))
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+
+	// 数据源恢复后重新加载，返回新的值
+	setFailing(nil)
+	if view, err := g.Get("Tom"); err != nil || view.Stale() {
+		t.Fatalf("expect a fresh value after recovery, but got %q, %v", view.String(), err)
+	}
+}
+
+func TestOnEvictedReentrant(t *testing.T) {
+	g := NewGroup("evict-reentrant", 10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("12345"), nil
+	}))
+	var evicted []string
+	var lens []int
+	g.mainCache.setOnEvicted(func(key string, value ByteView, reason lru.EvictReason) {
+		// 回调在释放锁之后调用，再次访问同一个缓存不会死锁
+		evicted = append(evicted, key)
+		lens = append(lens, g.mainCache.len())
+		g.Contains(key)
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, key := range []string{"k1", "k2", "k3"} {
+			g.Get(key)
+		}
+		g.Delete("k3")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("OnEvicted calling back into the cache deadlocked")
+	}
+	if !reflect.DeepEqual(evicted, []string{"k1", "k2", "k3"}) || !reflect.DeepEqual(lens, []int{1, 1, 0}) {
+		t.Fatalf("unexpected evictions %v with lengths %v", evicted, lens)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	var loads int64
+	g := NewGroup("touch", 2<<10, GetterWithTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		atomic.AddInt64(&loads, 1)
+		return []byte(key), 50 * time.Millisecond, nil
+	}))
+	if g.Touch("Tom") {
+		t.Fatalf("expect Touch to return false for a key which is not cached")
+	}
+	g.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	if !g.Touch("Tom") {
+		t.Fatalf("expect Touch to extend a cached key")
+	}
+	// 超过最初的过期时间后仍然被缓存，读取不会重新加载
+	time.Sleep(30 * time.Millisecond)
+	if !g.Contains("Tom") {
+		t.Fatalf("expect the touched key to survive past its original expiry")
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "Tom" || atomic.LoadInt64(&loads) != 1 {
+		t.Fatalf("expect Tom to be served from cache, but got %q, %v after %d loads", view.String(), err, loads)
+	}
+	// 没有再次 Touch，过期后被删除
+	time.Sleep(60 * time.Millisecond)
+	if g.Touch("Tom") {
+		t.Fatalf("expect Touch to return false for an expired key")
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	g := NewGroup("expvar", 8, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	read := func() map[string]int64 {
+		var vars map[string]map[string]int64
+		if err := json.Unmarshal([]byte(expvar.Get("dcache").String()), &vars); err != nil {
+			t.Fatalf("failed to decode expvar: %v", err)
+		}
+		return vars["expvar"]
+	}
+	if vars := read(); vars == nil || vars["misses"] != 0 {
+		t.Fatalf("expect the group to be published with zero counters, but got %v", vars)
+	}
+	g.Get("k1")
+	g.Get("k1")
+	g.Get("k2") // 每条记录占用 4 字节，缓存最多容纳 2 条记录
+	g.Get("k3")
+	vars := read()
+	expect := map[string]int64{"local_hits": 1, "misses": 3, "loads": 3, "evictions": 1, "entries": 2, "bytes": 8}
+	for name, want := range expect {
+		if vars[name] != want {
+			t.Fatalf("expect %s to be %d, but got %v", name, want, vars)
+		}
+	}
+}
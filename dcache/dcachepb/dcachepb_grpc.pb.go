@@ -0,0 +1,349 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: dcachepb.proto
+
+package dcachepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DCache_Get_FullMethodName          = "/dcachepb.DCache/Get"
+	DCache_Delete_FullMethodName       = "/dcachepb.DCache/Delete"
+	DCache_Set_FullMethodName          = "/dcachepb.DCache/Set"
+	DCache_GetMulti_FullMethodName     = "/dcachepb.DCache/GetMulti"
+	DCache_Clear_FullMethodName        = "/dcachepb.DCache/Clear"
+	DCache_Has_FullMethodName          = "/dcachepb.DCache/Has"
+	DCache_DeletePrefix_FullMethodName = "/dcachepb.DCache/DeletePrefix"
+)
+
+// DCacheClient is the client API for DCache service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DCacheClient interface {
+	Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Delete(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Set(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	GetMulti(ctx context.Context, in *MultiRequest, opts ...grpc.CallOption) (*MultiResponse, error)
+	Clear(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Has(ctx context.Context, in *Request, opts ...grpc.CallOption) (*HasResponse, error)
+	DeletePrefix(ctx context.Context, in *Request, opts ...grpc.CallOption) (*DeletePrefixResponse, error)
+}
+
+type dCacheClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDCacheClient(cc grpc.ClientConnInterface) DCacheClient {
+	return &dCacheClient{cc}
+}
+
+func (c *dCacheClient) Get(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, DCache_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) Delete(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, DCache_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) Set(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, DCache_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) GetMulti(ctx context.Context, in *MultiRequest, opts ...grpc.CallOption) (*MultiResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiResponse)
+	err := c.cc.Invoke(ctx, DCache_GetMulti_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) Clear(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, DCache_Clear_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) Has(ctx context.Context, in *Request, opts ...grpc.CallOption) (*HasResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HasResponse)
+	err := c.cc.Invoke(ctx, DCache_Has_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dCacheClient) DeletePrefix(ctx context.Context, in *Request, opts ...grpc.CallOption) (*DeletePrefixResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeletePrefixResponse)
+	err := c.cc.Invoke(ctx, DCache_DeletePrefix_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DCacheServer is the server API for DCache service.
+// All implementations must embed UnimplementedDCacheServer
+// for forward compatibility.
+type DCacheServer interface {
+	Get(context.Context, *Request) (*Response, error)
+	Delete(context.Context, *Request) (*Response, error)
+	Set(context.Context, *Request) (*Response, error)
+	GetMulti(context.Context, *MultiRequest) (*MultiResponse, error)
+	Clear(context.Context, *Request) (*Response, error)
+	Has(context.Context, *Request) (*HasResponse, error)
+	DeletePrefix(context.Context, *Request) (*DeletePrefixResponse, error)
+	mustEmbedUnimplementedDCacheServer()
+}
+
+// UnimplementedDCacheServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDCacheServer struct{}
+
+func (UnimplementedDCacheServer) Get(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedDCacheServer) Delete(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedDCacheServer) Set(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedDCacheServer) GetMulti(context.Context, *MultiRequest) (*MultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMulti not implemented")
+}
+func (UnimplementedDCacheServer) Clear(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Clear not implemented")
+}
+func (UnimplementedDCacheServer) Has(context.Context, *Request) (*HasResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Has not implemented")
+}
+func (UnimplementedDCacheServer) DeletePrefix(context.Context, *Request) (*DeletePrefixResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeletePrefix not implemented")
+}
+func (UnimplementedDCacheServer) mustEmbedUnimplementedDCacheServer() {}
+func (UnimplementedDCacheServer) testEmbeddedByValue()                {}
+
+// UnsafeDCacheServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DCacheServer will
+// result in compilation errors.
+type UnsafeDCacheServer interface {
+	mustEmbedUnimplementedDCacheServer()
+}
+
+func RegisterDCacheServer(s grpc.ServiceRegistrar, srv DCacheServer) {
+	// If the following call pancis, it indicates UnimplementedDCacheServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DCache_ServiceDesc, srv)
+}
+
+func _DCache_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).Get(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).Delete(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).Set(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_GetMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).GetMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_GetMulti_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).GetMulti(ctx, req.(*MultiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_Clear_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).Clear(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_Clear_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).Clear(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_Has_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).Has(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_Has_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).Has(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DCache_DeletePrefix_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DCacheServer).DeletePrefix(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DCache_DeletePrefix_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DCacheServer).DeletePrefix(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DCache_ServiceDesc is the grpc.ServiceDesc for DCache service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DCache_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dcachepb.DCache",
+	HandlerType: (*DCacheServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _DCache_Get_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _DCache_Delete_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _DCache_Set_Handler,
+		},
+		{
+			MethodName: "GetMulti",
+			Handler:    _DCache_GetMulti_Handler,
+		},
+		{
+			MethodName: "Clear",
+			Handler:    _DCache_Clear_Handler,
+		},
+		{
+			MethodName: "Has",
+			Handler:    _DCache_Has_Handler,
+		},
+		{
+			MethodName: "DeletePrefix",
+			Handler:    _DCache_DeletePrefix_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "dcachepb.proto",
+}
@@ -0,0 +1,222 @@
+package dcachetest
+
+import (
+	"DCache/dcache"
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 用于测试的远程节点替身，不经过网络，可以按 key 编排返回值、错误与延迟，
+// 从而确定性地测试 Group 从远程节点获取、失败后回退到本地等逻辑。
+//
+//	peer := dcachetest.NewMockPeerGetter()
+//	peer.SetResponse("Tom", dcachetest.Response{Err: errors.New("peer down")})
+//	picker := dcachetest.NewMockPeerPicker()
+//	picker.SetDefault(peer)
+//	g.RegisterPeers(picker)
+
+// Response scripts how MockPeerGetter replies to a key.
+type Response struct {
+	Value   []byte
+	Err     error         // 不为 nil 时返回该错误
+	Latency time.Duration // 返回之前等待的时间，等待期间 ctx 被取消则返回 ctx.Err()
+}
+
+// MockPeerGetter implements dcache.PeerGetter with scripted responses.
+// 未编排的 key 返回 dcache.ErrNotFound；Set 写入的值会作为之后 Get 的返回值
+type MockPeerGetter struct {
+	// Timeout 模拟真实传输层的客户端超时：Latency 不小于 Timeout 时，等待 Timeout 后返回 context.DeadlineExceeded，
+	// 而调用方的 ctx 并未被取消。0 表示没有超时
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	responses map[string]Response
+	calls     map[string]int
+}
+
+var _ dcache.PeerGetter = (*MockPeerGetter)(nil)
+
+func NewMockPeerGetter() *MockPeerGetter {
+	return &MockPeerGetter{
+		responses: make(map[string]Response),
+		calls:     make(map[string]int),
+	}
+}
+
+// SetResponse scripts the response for key.
+func (m *MockPeerGetter) SetResponse(key string, r Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[key] = r
+}
+
+// Calls returns how many times key has been requested by Get, GetMulti and Has.
+func (m *MockPeerGetter) Calls(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[key]
+}
+
+// reply 记录一次请求，并按照编排等待后返回 key 对应的响应
+func (m *MockPeerGetter) reply(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	m.calls[key]++
+	r, ok := m.responses[key]
+	timeout := m.Timeout
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", dcache.ErrNotFound, key)
+	}
+	latency, timedOut := r.Latency, false
+	if timeout > 0 && latency >= timeout {
+		latency, timedOut = timeout, true
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if timedOut {
+		return nil, fmt.Errorf("mock peer: %w", context.DeadlineExceeded)
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return r.Value, nil
+}
+
+func (m *MockPeerGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	value, err := m.reply(ctx, in.Key)
+	if err != nil {
+		return err
+	}
+	out.Value = value
+	return nil
+}
+
+func (m *MockPeerGetter) Delete(ctx context.Context, in *pb.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.responses, in.Key)
+	return nil
+}
+
+func (m *MockPeerGetter) Set(ctx context.Context, in *pb.Request) error {
+	m.SetResponse(in.Key, Response{Value: in.Value})
+	return nil
+}
+
+func (m *MockPeerGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	out.Values = make(map[string][]byte)
+	out.Errors = make(map[string]string)
+	for _, key := range in.Keys {
+		value, err := m.reply(ctx, key)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			out.Errors[key] = err.Error()
+			continue
+		}
+		out.Values[key] = value
+	}
+	return nil
+}
+
+func (m *MockPeerGetter) Clear(ctx context.Context, in *pb.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = make(map[string]Response)
+	return nil
+}
+
+func (m *MockPeerGetter) Has(ctx context.Context, in *pb.Request) (bool, error) {
+	_, err := m.reply(ctx, in.Key)
+	return err == nil, nil
+}
+
+func (m *MockPeerGetter) DeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key := range m.responses {
+		if strings.HasPrefix(key, in.Key) {
+			delete(m.responses, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MockPeerPicker implements dcache.PeerPicker and dcache.PeerLister with a fixed routing table.
+// key 优先路由到 SetPeer 指定的节点，其次是 SetDefault 指定的节点；都没有时视为归属于本节点
+type MockPeerPicker struct {
+	mu    sync.Mutex
+	peers map[string]dcache.PeerGetter
+	def   dcache.PeerGetter
+}
+
+var (
+	_ dcache.PeerPicker = (*MockPeerPicker)(nil)
+	_ dcache.PeerLister = (*MockPeerPicker)(nil)
+)
+
+func NewMockPeerPicker() *MockPeerPicker {
+	return &MockPeerPicker{peers: make(map[string]dcache.PeerGetter)}
+}
+
+// SetPeer routes key to peer, a nil peer makes key owned by this node.
+func (p *MockPeerPicker) SetPeer(key string, peer dcache.PeerGetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers[key] = peer
+}
+
+// SetDefault routes the keys without a SetPeer to peer, nil makes them owned by this node.
+func (p *MockPeerPicker) SetDefault(peer dcache.PeerGetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.def = peer
+}
+
+// PickPeer picks the peer routed for key
+func (p *MockPeerPicker) PickPeer(key string) (dcache.PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peer, ok := p.peers[key]
+	if !ok {
+		peer = p.def
+	}
+	return peer, peer != nil
+}
+
+// Peers returns the distinct peers in the routing table, implements dcache.PeerLister.
+func (p *MockPeerPicker) Peers() []dcache.PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[dcache.PeerGetter]bool)
+	var peers []dcache.PeerGetter
+	for _, peer := range append([]dcache.PeerGetter{p.def}, mapValues(p.peers)...) {
+		if peer != nil && !seen[peer] {
+			seen[peer] = true
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func mapValues(m map[string]dcache.PeerGetter) []dcache.PeerGetter {
+	values := make([]dcache.PeerGetter, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,78 @@
+package dcachetest
+
+import (
+	"DCache/dcache"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoadFallback(t *testing.T) {
+	loads := make(map[string]int)
+	g := dcache.NewGroup("mock-peer", 2<<10, dcache.GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte("local:" + key), nil
+	}))
+	peer := NewMockPeerGetter()
+	peer.Timeout = 20 * time.Millisecond
+	peer.SetResponse("ok", Response{Value: []byte("peer:ok")})
+	peer.SetResponse("error", Response{Err: errors.New("peer down")})
+	peer.SetResponse("timeout", Response{Value: []byte("peer:timeout"), Latency: time.Hour})
+	picker := NewMockPeerPicker()
+	picker.SetDefault(peer)
+	g.RegisterPeers(picker)
+
+	for _, c := range []struct {
+		key    string
+		value  string
+		source dcache.Source
+	}{
+		// 从远程节点获取成功，不调用回调函数
+		{"ok", "peer:ok", dcache.SourcePeer},
+		// 远程节点返回错误，回退到本地获取
+		{"error", "local:error", dcache.SourceGetter},
+		// 远程节点超时，回退到本地获取
+		{"timeout", "local:timeout", dcache.SourceGetter},
+	} {
+		view, source, err := g.GetWithSource(c.key)
+		if err != nil || view.String() != c.value || source != c.source {
+			t.Fatalf("GetWithSource(%s) = %q, %v, %v, expect %q from %v", c.key, view.String(), source, err, c.value, c.source)
+		}
+		if peer.Calls(c.key) != 1 {
+			t.Fatalf("expect %s to be requested from the peer once, but got %d", c.key, peer.Calls(c.key))
+		}
+	}
+	if loads["ok"] != 0 || loads["error"] != 1 || loads["timeout"] != 1 {
+		t.Fatalf("unexpected getter calls %v", loads)
+	}
+
+	// 调用方的 ctx 被取消时不会回退
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	picker.SetPeer("cancelled", peer)
+	peer.SetResponse("cancelled", Response{Latency: 10 * time.Millisecond})
+	if _, err := g.GetContext(ctx, "cancelled"); !errors.Is(err, context.DeadlineExceeded) || loads["cancelled"] != 0 {
+		t.Fatalf("expect a cancelled request not to fall back, got %v", err)
+	}
+}
+
+func TestMockPeerPicker(t *testing.T) {
+	a, b := NewMockPeerGetter(), NewMockPeerGetter()
+	picker := NewMockPeerPicker()
+	picker.SetDefault(a)
+	picker.SetPeer("Tom", b)
+	picker.SetPeer("Jack", nil)
+	if peer, ok := picker.PickPeer("Tom"); !ok || peer != b {
+		t.Fatalf("expect Tom to be routed to b")
+	}
+	if peer, ok := picker.PickPeer("Sam"); !ok || peer != a {
+		t.Fatalf("expect Sam to be routed to the default peer")
+	}
+	if _, ok := picker.PickPeer("Jack"); ok {
+		t.Fatalf("expect Jack to be owned by this node")
+	}
+	if peers := picker.Peers(); len(peers) != 2 {
+		t.Fatalf("expect 2 distinct peers, but got %d", len(peers))
+	}
+}
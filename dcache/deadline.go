@@ -0,0 +1,52 @@
+package dcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 截止时间传递：调用方的 ctx 带有截止时间时，httpGetter 通过请求头将剩余的时间传给远程节点，
+// 远程节点据此为 Group.Get 设置同样的截止时间，调用方放弃等待后远程节点也会中止加载，避免无用的数据库查询。
+// 传递的是剩余时间而不是绝对时间，不受节点间时钟偏差的影响。
+
+const (
+	// 请求头的值为剩余的毫秒数
+	timeoutHeader = "X-Dcache-Timeout"
+	// 剩余时间不足 minPeerBudget 时，远程节点直接返回超时，不再加载
+	minPeerBudget = 5 * time.Millisecond
+)
+
+// setTimeoutHeader 将 req 的 ctx 的剩余时间写入请求头，没有截止时间时不写入
+func setTimeoutHeader(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	req.Header.Set(timeoutHeader, strconv.FormatInt(remaining, 10))
+}
+
+// requestContext 按照请求头中的剩余时间为请求的 ctx 设置截止时间，
+// 剩余时间不足 minPeerBudget 时返回 context.DeadlineExceeded
+func requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	header := r.Header.Get(timeoutHeader)
+	if header == "" {
+		return r.Context(), func() {}, nil
+	}
+	ms, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || ms < 0 {
+		return nil, nil, fmt.Errorf("invalid %s header: %q", timeoutHeader, header)
+	}
+	budget := time.Duration(ms) * time.Millisecond
+	if budget < minPeerBudget {
+		return nil, nil, fmt.Errorf("%w: remaining budget %v is too small", context.DeadlineExceeded, budget)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"context"
+)
+
+// 服务发现：节点启动时将自己的地址注册到注册中心，并监听集群成员的变化，
+// 通过 HTTPPool.AddPeers / RemovePeers 增量地更新哈希环，而不是在 main.go 中写死所有节点的地址。
+
+// EventType is the type of a membership change.
+type EventType int
+
+const (
+	Add    EventType = iota // 节点加入集群
+	Remove                  // 节点离开集群
+)
+
+// Event describes a peer joining or leaving the cluster.
+type Event struct {
+	Type EventType
+	Addr string
+}
+
+// Registry is a service registry which stores the addresses of live peers.
+// 不同的注册中心（etcd、Consul、静态配置等）只需实现该接口即可接入。
+type Registry interface {
+	// Register 注册本节点的地址，直到 ctx 被取消或者节点失效前，其他节点都能发现该地址
+	Register(ctx context.Context, addr string) error
+	// Watch 先为当前所有节点发送 Add 事件，之后持续发送成员变化的事件，ctx 被取消后关闭返回的 channel
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// Peers is the set of peers updated by Sync, dcache.HTTPPool implements it.
+type Peers interface {
+	AddPeers(peers ...string)
+	RemovePeers(peers ...string)
+}
+
+// Sync watches r and applies the membership changes to peers until ctx is cancelled.
+func Sync(ctx context.Context, r Registry, peers Peers) error {
+	events, err := r.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		switch event.Type {
+		case Add:
+			peers.AddPeers(event.Addr)
+		case Remove:
+			peers.RemovePeers(event.Addr)
+		}
+	}
+	return ctx.Err()
+}
+
+// Static is a Registry with a fixed list of peers, Register is a no-op.
+type Static []string
+
+func (s Static) Register(ctx context.Context, addr string) error {
+	return nil
+}
+
+func (s Static) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event, len(s))
+	for _, addr := range s {
+		ch <- Event{Type: Add, Addr: addr}
+	}
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
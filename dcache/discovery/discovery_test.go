@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"DCache/dcache"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeRegistry 将 events 中的事件依次发送给 Watch 的调用方
+type fakeRegistry struct {
+	events chan Event
+}
+
+func (r *fakeRegistry) Register(ctx context.Context, addr string) error {
+	r.events <- Event{Type: Add, Addr: addr}
+	return nil
+}
+
+func (r *fakeRegistry) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case event := <-r.events:
+				ch <- event
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func waitPeers(t *testing.T, pool *dcache.HTTPPool, expect []string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if peers := pool.HealthyPeers(); reflect.DeepEqual(peers, expect) {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expect peers %v, but got %v", expect, peers)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	r := &fakeRegistry{events: make(chan Event, 10)}
+	pool := dcache.NewHTTPPool("http://localhost:8001")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Sync(ctx, r, pool) }()
+
+	_ = r.Register(ctx, "http://localhost:8001")
+	_ = r.Register(ctx, "http://localhost:8002")
+	waitPeers(t, pool, []string{"http://localhost:8001", "http://localhost:8002"})
+
+	r.events <- Event{Type: Remove, Addr: "http://localhost:8002"}
+	waitPeers(t, pool, []string{"http://localhost:8001"})
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Sync should stop when ctx is cancelled, but got %v", err)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	pool := dcache.NewHTTPPool("http://localhost:8001")
+	ctx, cancel := context.WithCancel(context.Background())
+	go Sync(ctx, Static{"http://localhost:8001", "http://localhost:8003"}, pool)
+	waitPeers(t, pool, []string{"http://localhost:8001", "http://localhost:8003"})
+	cancel()
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"context"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// defaultLeaseTTL 为注册的租约时间（秒），节点宕机后最多经过该时间就会从注册中心中移除
+const defaultLeaseTTL = 10
+
+// Etcd is a Registry backed by etcd.
+// 每个节点以 <prefix><addr> 为 key 写入 etcd，并绑定一个持续续约的租约，节点宕机后租约过期，key 被自动删除。
+type Etcd struct {
+	client *clientv3.Client
+	prefix string
+}
+
+var _ Registry = (*Etcd)(nil)
+
+// NewEtcd creates an Etcd registry which stores peers under prefix, e.g. "/dcache/peers/".
+func NewEtcd(client *clientv3.Client, prefix string) *Etcd {
+	return &Etcd{client: client, prefix: prefix}
+}
+
+// Register puts addr into etcd and keeps the lease alive in background until ctx is cancelled.
+func (e *Etcd) Register(ctx context.Context, addr string) error {
+	lease, err := e.client.Grant(ctx, defaultLeaseTTL)
+	if err != nil {
+		return err
+	}
+	if _, err = e.client.Put(ctx, e.prefix+addr, addr, clientv3.WithLease(lease.ID)); err != nil {
+		return err
+	}
+	keepAlive, err := e.client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// 必须消费续约的响应，否则 channel 写满后 etcd 客户端会打印警告
+		for range keepAlive {
+		}
+	}()
+	return nil
+}
+
+// Watch sends the peers under prefix and their changes.
+func (e *Etcd) Watch(ctx context.Context) (<-chan Event, error) {
+	res, err := e.client.Get(ctx, e.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		ch <- Event{Type: Add, Addr: strings.TrimPrefix(string(kv.Key), e.prefix)}
+	}
+	// 从 Get 之后的版本开始监听，保证不会遗漏两者之间的变化
+	watch := e.client.Watch(ctx, e.prefix, clientv3.WithPrefix(), clientv3.WithRev(res.Header.Revision+1))
+	go func() {
+		defer close(ch)
+		for wr := range watch {
+			for _, ev := range wr.Events {
+				event := Event{Type: Add, Addr: strings.TrimPrefix(string(ev.Kv.Key), e.prefix)}
+				if ev.Type == clientv3.EventTypeDelete {
+					event.Type = Remove
+				}
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,31 @@
+package dcache
+
+import "expvar"
+
+// expvar 指标：不依赖 Prometheus 等第三方库，通过标准库 expvar 发布每个 Group 的统计信息，
+// 导入本包后即可通过默认的 /debug/vars 查看，格式为
+//
+//	"dcache": {"<group>": {"local_hits": 1, "misses": 2, ...}}
+//
+// 每个指标都是读取 Stats 计数器的 expvar.Func，与 Stats、_stats 共用同一处统计，不会重复计数。
+
+var expvarGroups = expvar.NewMap("dcache")
+
+// publishExpvar 发布 g 的统计信息，同名的 Group 会替换之前发布的指标
+func publishExpvar(g *Group) {
+	m := new(expvar.Map)
+	for name, fn := range map[string]func(s Stats) int64{
+		"local_hits": func(s Stats) int64 { return s.LocalHits },
+		"misses":     func(s Stats) int64 { return s.Misses },
+		"peer_hits":  func(s Stats) int64 { return s.PeerHits },
+		"loads":      func(s Stats) int64 { return s.Loads },
+		"errors":     func(s Stats) int64 { return s.Errors },
+		"evictions":  func(s Stats) int64 { return s.Evictions },
+	} {
+		fn := fn
+		m.Set(name, expvar.Func(func() interface{} { return fn(g.Stats()) }))
+	}
+	m.Set("entries", expvar.Func(func() interface{} { return g.mainCache.len() }))
+	m.Set("bytes", expvar.Func(func() interface{} { return g.mainCache.bytes() }))
+	expvarGroups.Set(g.name, m)
+}
@@ -0,0 +1,264 @@
+package grpcpool
+
+import (
+	"DCache/dcache"
+	"DCache/dcache/consistenthash"
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// 基于 gRPC 的节点间通信，是 HTTPPool 的替代方案，同样通过 Group.RegisterPeers 注入到 Group 中。
+
+const defaultReplicas = 50
+
+// GRPCPool implements dcache.PeerPicker for a pool of gRPC peers.
+type GRPCPool struct {
+	self    string // 用来记录自己的地址，格式为 host:port
+	opts    []grpc.DialOption
+	mu      sync.Mutex
+	peers   *consistenthash.Map    // 用于根据具体的key选择节点
+	getters map[string]*grpcGetter // 映射远程节点与对应的grpcGetter
+	logger  dcache.Logger
+}
+
+var (
+	_ dcache.PeerPicker = (*GRPCPool)(nil)
+	_ dcache.PeerLister = (*GRPCPool)(nil)
+)
+
+// NewGRPCPool creates a GRPCPool, opts are used to dial remote peers.
+// 未指定 opts 时使用不加密的连接
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GRPCPool{
+		self:   self,
+		opts:   opts,
+		logger: log.New(io.Discard, "", 0),
+	}
+}
+
+// SetLogger sets the logger of the pool, nil disables logging.
+func (p *GRPCPool) SetLogger(logger dcache.Logger) {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	p.logger = logger
+}
+
+// Log info with server name
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	p.logger.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set updates the pool's list of peers.
+// 与 HTTPPool.Set 相同，重建一致性哈希环，并为每个节点创建一个 gRPC 客户端，旧的连接会被关闭
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		conn, err := grpc.NewClient(peer, p.opts...)
+		if err != nil {
+			for _, getter := range getters {
+				getter.conn.Close()
+			}
+			return err
+		}
+		getters[peer] = &grpcGetter{conn: conn, client: pb.NewDCacheClient(conn)}
+	}
+	p.closeLocked()
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.getters = getters
+	return nil
+}
+
+// PickPeer picks a peer according to key
+func (p *GRPCPool) PickPeer(key string) (dcache.PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// Peers returns the clients of all remote peers, implements dcache.PeerLister.
+func (p *GRPCPool) Peers() []dcache.PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]dcache.PeerGetter, 0, len(p.getters))
+	for peer, getter := range p.getters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+// Close closes the connections to all peers.
+func (p *GRPCPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+	p.getters = nil
+}
+
+func (p *GRPCPool) closeLocked() {
+	for _, getter := range p.getters {
+		getter.conn.Close()
+	}
+}
+
+// Register registers the DCache service on s, so that remote peers can access this node.
+func (p *GRPCPool) Register(s *grpc.Server) {
+	pb.RegisterDCacheServer(s, &server{})
+}
+
+// server 实现了 pb.DCacheServer，基于 dcache.Serve* 响应远程节点的请求
+type server struct {
+	pb.UnimplementedDCacheServer
+}
+
+func (s *server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	out := &pb.Response{}
+	if err := dcache.ServeGet(ctx, in, out); err != nil {
+		return nil, grpcError(err)
+	}
+	return out, nil
+}
+
+func (s *server) Delete(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	if err := dcache.ServeDelete(ctx, in); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.Response{}, nil
+}
+
+func (s *server) Set(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	if err := dcache.ServeSet(ctx, in); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.Response{}, nil
+}
+
+func (s *server) GetMulti(ctx context.Context, in *pb.MultiRequest) (*pb.MultiResponse, error) {
+	out := &pb.MultiResponse{}
+	if err := dcache.ServeGetMulti(ctx, in, out); err != nil {
+		return nil, grpcError(err)
+	}
+	return out, nil
+}
+
+func (s *server) Clear(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	if err := dcache.ServeClear(ctx, in); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.Response{}, nil
+}
+
+func (s *server) Has(ctx context.Context, in *pb.Request) (*pb.HasResponse, error) {
+	exists, err := dcache.ServeHas(ctx, in)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.HasResponse{Exists: exists}, nil
+}
+
+func (s *server) DeletePrefix(ctx context.Context, in *pb.Request) (*pb.DeletePrefixResponse, error) {
+	n, err := dcache.ServeDeletePrefix(ctx, in)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeletePrefixResponse{Deleted: int64(n)}, nil
+}
+
+// grpcError 将错误转换为对应的 gRPC 状态码
+func grpcError(err error) error {
+	if errors.Is(err, dcache.ErrNoSuchGroup) || errors.Is(err, dcache.ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// grpcGetter 为 gRPC 客户端类，实现了 dcache.PeerGetter
+type grpcGetter struct {
+	conn   *grpc.ClientConn
+	client pb.DCacheClient
+}
+
+var _ dcache.PeerGetter = (*grpcGetter)(nil)
+
+func (g *grpcGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	res, err := g.client.Get(ctx, in)
+	if status.Code(err) == codes.NotFound {
+		// 与 httpGetter 相同，将 NotFound 还原为 dcache.ErrNotFound
+		return fmt.Errorf("%w: %v", dcache.ErrNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return dcache.VerifyChecksum(out)
+}
+
+func (g *grpcGetter) Delete(ctx context.Context, in *pb.Request) error {
+	_, err := g.client.Delete(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *pb.Request) error {
+	_, err := g.client.Set(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	res, err := g.client.GetMulti(ctx, in)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) Clear(ctx context.Context, in *pb.Request) error {
+	_, err := g.client.Clear(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) Has(ctx context.Context, in *pb.Request) (bool, error) {
+	res, err := g.client.Has(ctx, in)
+	if status.Code(err) == codes.NotFound {
+		// 远程节点上不存在该 group，自然也没有缓存该 key
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.Exists, nil
+}
+
+func (g *grpcGetter) DeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	res, err := g.client.DeletePrefix(ctx, in)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.Deleted), nil
+}
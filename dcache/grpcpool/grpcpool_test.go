@@ -0,0 +1,95 @@
+package grpcpool
+
+import (
+	"DCache/dcache"
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// startServer 启动一个进程内的 gRPC 服务器，返回其地址与收到的请求数
+func startServer(t *testing.T) (string, *int64) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int64
+	s := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			atomic.AddInt64(&calls, 1)
+			return handler(ctx, req)
+		}))
+	NewGRPCPool(lis.Addr().String()).Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), &calls
+}
+
+func TestRoundTrip(t *testing.T) {
+	dcache.NewGroup("grpc", 2<<10, dcache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, dcache.ErrNotFound
+		}
+		return []byte("value of " + key), nil
+	}))
+
+	addrA, _ := startServer(t)
+	addrB, callsB := startServer(t)
+	pool := NewGRPCPool(addrA)
+	if err := pool.Set(addrA, addrB); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// 找到一个归属于节点 B 的 key，节点 A 自己的 key 不会被选中
+	var key string
+	var peer dcache.PeerGetter
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		var ok bool
+		if peer, ok = pool.PickPeer(key); ok {
+			break
+		}
+	}
+
+	out := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "grpc", Key: key}, out); err != nil || string(out.Value) != "value of "+key {
+		t.Fatalf("failed to get %s over grpc: %q, %v", key, out.Value, err)
+	}
+	if atomic.LoadInt64(callsB) != 1 {
+		t.Fatalf("%s should be served by the remote peer", key)
+	}
+
+	if err := peer.Set(context.Background(), &pb.Request{Group: "grpc", Key: key, Value: []byte("new")}); err != nil {
+		t.Fatalf("failed to set %s over grpc: %v", key, err)
+	}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "grpc", Key: key}, out); err != nil || string(out.Value) != "new" {
+		t.Fatalf("failed to get %s over grpc after set: %q, %v", key, out.Value, err)
+	}
+
+	multi := &pb.MultiResponse{}
+	if err := peer.GetMulti(context.Background(), &pb.MultiRequest{Group: "grpc", Keys: []string{key, "other"}}, multi); err != nil ||
+		string(multi.Values[key]) != "new" || string(multi.Values["other"]) != "value of other" {
+		t.Fatalf("failed to get multi over grpc: %v, %v", multi.Values, err)
+	}
+
+	if err := peer.Delete(context.Background(), &pb.Request{Group: "grpc", Key: key}); err != nil {
+		t.Fatalf("failed to delete %s over grpc: %v", key, err)
+	}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "grpc", Key: key}, out); err != nil || string(out.Value) != "value of "+key {
+		t.Fatalf("%s should be reloaded after delete over grpc: %q, %v", key, out.Value, err)
+	}
+
+	if err := peer.Get(context.Background(), &pb.Request{Group: "grpc", Key: "missing"}, out); !errors.Is(err, dcache.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound over grpc, but got %v", err)
+	}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "unknown", Key: key}, out); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
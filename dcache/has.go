@@ -0,0 +1,47 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"time"
+)
+
+// Has reports whether key is cached, without loading it or transferring its value.
+// 先检查本节点的缓存（包括 L1 和热点 key 的副本），key 归属于远程节点时再向该节点发送一个轻量的查询请求。
+// 只判断 key 是否已被缓存，不会调用回调函数，因此数据源中存在但尚未缓存的 key 返回 false；
+// 缓存的 ErrNotFound 以及查询远程节点失败同样返回 false
+func (g *Group) Has(key string) bool {
+	if g.checkKey(key) != nil {
+		return false
+	}
+	if g.hasLocally(key) {
+		return true
+	}
+	if g.peers != nil {
+		if peer, ok := g.pickPrimary(key); ok {
+			if g.l1 != nil {
+				if _, ok := g.l1.peek(key); ok {
+					return true
+				}
+			}
+			if g.hot != nil {
+				if _, ok := g.hot.peek(key); ok {
+					return true
+				}
+			}
+			exists, err := peer.Has(context.Background(), &pb.Request{Group: g.name, Key: key})
+			if err != nil {
+				g.logger.Printf("[dcache] Failed to check %s on peer: %v", key, err)
+				return false
+			}
+			return exists
+		}
+	}
+	return false
+}
+
+// hasLocally 只检查本节点的 mainCache，不会更新 key 的访问记录
+func (g *Group) hasLocally(key string) bool {
+	v, ok := g.mainCache.peek(key)
+	return ok && v.err == nil && !v.expired(time.Now())
+}
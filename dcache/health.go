@@ -0,0 +1,135 @@
+package dcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 节点健康检查：后台定期访问每个远程节点的 /<basepath>/_health，连续失败 defaultHealthFailures 次后，
+// 将节点从一致性哈希环中移除，PickPeer 不会再选中它；节点恢复后重新加入哈希环。
+
+const (
+	healthPath            = "_health" // 健康检查的访问路径为 /<basepath>/_health
+	defaultHealthFailures = 3
+)
+
+// StartHealthCheck starts checking the health of peers every interval in background.
+// interval 必须大于 0，否则直接 panic，而不是在后台 goroutine 中 panic 导致进程退出
+func (p *HTTPPool) StartHealthCheck(interval time.Duration) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("HTTPPool health check interval must be positive: %v", interval))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopHealth != nil {
+		return
+	}
+	stop := make(chan struct{})
+	p.stopHealth = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkPeers()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthCheck stops the background health checker started by StartHealthCheck.
+func (p *HTTPPool) StopHealthCheck() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopHealth != nil {
+		close(p.stopHealth)
+		p.stopHealth = nil
+	}
+}
+
+// HealthyPeers returns the peers which are currently in the ring.
+func (p *HTTPPool) HealthyPeers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		if !p.unhealthy[peer] {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// checkPeers 并发检查所有远程节点，检查过程中不持有锁
+func (p *HTTPPool) checkPeers() {
+	p.mu.Lock()
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if !p.isSelf(peer) {
+			getters[peer] = getter
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for peer, getter := range getters {
+		wg.Add(1)
+		go func(peer string, getter *httpGetter) {
+			defer wg.Done()
+			p.updateHealth(peer, getter, getter.ping() == nil)
+		}(peer, getter)
+	}
+	wg.Wait()
+}
+
+func (p *HTTPPool) updateHealth(peer string, getter *httpGetter, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.httpGetters[peer] != getter {
+		// 检查期间节点列表已被 Set 更新，或者配置修改后 httpGetter 已被替换
+		return
+	}
+	if ok {
+		p.failures[peer] = 0
+		if p.unhealthy[peer] {
+			delete(p.unhealthy, peer)
+			p.peers.Add(peer)
+			p.Log("peer %s recovered, add it back to the ring", peer)
+		}
+		return
+	}
+	p.failures[peer]++
+	if p.failures[peer] >= defaultHealthFailures && !p.unhealthy[peer] {
+		p.unhealthy[peer] = true
+		p.peers.Remove(peer)
+		p.Log("peer %s is unhealthy, remove it from the ring", peer)
+	}
+}
+
+// ping 访问远程节点的健康检查地址，返回 200 即认为节点健康
+func (h *httpGetter) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return errors.New("server returned: " + res.Status)
+	}
+	return nil
+}
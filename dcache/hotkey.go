@@ -0,0 +1,86 @@
+package dcache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 热点 key 复制：归属于远程节点的 key 在本节点被频繁读取时，每次读取都会访问同一个归属节点，
+// 单个热点 key 就可能压垮该节点。开启后本节点按秒统计每个远程 key 的访问次数，
+// 访问频率达到阈值的 key 从归属节点获取成功后在本节点保留一份副本，ttl 内的读取直接由本节点返回。
+// 与 L1 不同，只有热点 key 才会占用本地内存；副本最多旧 ttl，本节点的 Set、Delete 会立即删除副本。
+
+// hotKeyWindow 为统计访问频率的时间窗口
+const hotKeyWindow = time.Second
+
+// SetHotKeyReplication replicates keys owned by remote peers which are read more than threshold times
+// per second on this node, serving them locally for ttl.
+// 副本占用的内存最多为 mainCache 容量的 1/8，threshold <= 0 或 ttl <= 0 时关闭
+func (g *Group) SetHotKeyReplication(threshold float64, ttl time.Duration) {
+	if threshold <= 0 || ttl <= 0 {
+		g.hotKeys, g.hot, g.hotTTL = nil, nil, 0
+		return
+	}
+	g.hotKeys = newHotKeys(threshold, hotKeyWindow)
+	g.hot, g.hotTTL = &cache{cacheBytes: g.mainCache.cacheBytes / 8}, ttl
+}
+
+// hotKeys 在一个固定时间窗口内统计每个 key 的访问次数，窗口结束后重新计数
+type hotKeys struct {
+	mu     sync.Mutex
+	limit  int // 一个窗口内的访问次数达到 limit 即为热点 key
+	window time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+func newHotKeys(threshold float64, window time.Duration) *hotKeys {
+	limit := int(math.Ceil(threshold * window.Seconds()))
+	if limit < 1 {
+		limit = 1
+	}
+	return &hotKeys{limit: limit, window: window, start: time.Now(), counts: make(map[string]int)}
+}
+
+// record 记录一次对 key 的访问，返回 key 在当前窗口内是否已经成为热点 key
+func (h *hotKeys) record(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now := time.Now(); now.Sub(h.start) >= h.window {
+		h.start = now
+		h.counts = make(map[string]int)
+	}
+	h.counts[key]++
+	return h.counts[key] >= h.limit
+}
+
+// recordAccess 记录一次从远程节点读取 key，未开启热点 key 复制时返回 false
+func (g *Group) recordAccess(key string) bool {
+	if g.hotKeys == nil {
+		return false
+	}
+	return g.hotKeys.record(key)
+}
+
+// lookupHot 查找本节点保存的热点 key 副本
+func (g *Group) lookupHot(key string) (ByteView, bool) {
+	if g.hot == nil {
+		return ByteView{}, false
+	}
+	return g.hot.get(key)
+}
+
+// replicateHot 保存从远程节点获取到的热点 key 的副本
+func (g *Group) replicateHot(key string, value ByteView) {
+	if g.hot != nil {
+		g.hot.addWithTTL(key, value, g.hotTTL)
+	}
+}
+
+// removeHot 删除热点 key 的副本
+func (g *Group) removeHot(key string) {
+	if g.hot != nil {
+		g.hot.remove(key)
+	}
+}
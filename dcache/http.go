@@ -3,21 +3,39 @@ package dcache
 import (
 	"DCache/dcache/consistenthash"
 	pb "DCache/dcache/dcachepb"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"github.com/golang/protobuf/proto"
 	"io"
-	"log"
+	"math/rand"
+	"net"
 	"net/http"
-	"net/url"
 	"strings"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // 提供被其他节点访问的能力（基于http）
 
 const (
+	batchPath       = "_batch"  // 批量获取的访问路径为 /<basepath>/_batch/<groupname>
+	clearPath       = "_clear"  // 清空 group 的访问路径为 /<basepath>/_clear/<groupname>
+	prefixPath      = "_prefix" // 按前缀删除的访问路径为 /<basepath>/_prefix/<groupname>，前缀放在请求 body 中
 	defaultBasePath = "/_dcache/"
 	defaultReplicas = 50
+	defaultTimeout  = 2 * time.Second
+
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+
+	// 客户端通过该请求头声明接受压缩后的缓存值，对应 pb.Request.AcceptCompressed
+	acceptCompressedHeader = "X-Dcache-Accept-Compressed"
 )
 
 // 承载节点间HTTP通信的核心数据结构
@@ -30,109 +48,809 @@ type HTTPPool struct {
 	mu          sync.Mutex
 	peers       *consistenthash.Map    // 用于根据具体的key选择节点
 	httpGetters map[string]*httpGetter // 映射远程节点与对应的httpGetter
+	client      *http.Client           // 所有 httpGetter 共用的HTTP客户端，复用连接池
+	failures    map[string]int         // 健康检查时节点连续失败的次数
+	unhealthy   map[string]bool        // 被健康检查从哈希环中移除的节点
+	stopHealth  chan struct{}          // 关闭后停止健康检查
+	opts        HTTPPoolOptions
+	sem         chan struct{} // 所有 httpGetter 共用的信号量，为 nil 时不限制并发请求数
+	logger      Logger
+	server      *http.Server // Serve 时创建，Shutdown 时关闭
+	tracer      trace.Tracer
+	// breakerFailures, breakerCooldown 为新建 httpGetter 时熔断器的配置
+	breakerFailures int
+	breakerCooldown time.Duration
+	selfMatcher     func(self, peer string) bool // 判断节点是否为本节点，nil 表示严格比较字符串
+	readReplicas    int                          // 读请求分摊到的副本数，<= 1 表示只从主节点读取
+	codec           Codec                        // 访问远程节点时使用的编码，服务端同样接受
+	// adaptiveReplicas 为 true 时，虚拟节点个数按照节点数计算，而不是使用 opts.Replicas
+	adaptiveReplicas bool
+	retry            retryPolicy // 新建 httpGetter 时 Get 请求的重试策略
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+// 哈希环在 Set 时按照这些配置创建，因此修改 Replicas 或 HashFn 后需要重新调用 Set 完整地重建哈希环，
+// 否则新旧配置下 key 与节点的映射不一致。
+type HTTPPoolOptions struct {
+	// Replicas 为每个真实节点对应的虚拟节点个数，0 表示使用默认值 50。
+	// 集群较大时可以调大以获得更均衡的分布，集群很小时可以调小以节省内存。
+	Replicas int
+	// HashFn 为哈希环使用的哈希函数，nil 表示使用 crc32.ChecksumIEEE。
+	// key 为顺序递增的 ID 时可以选择 consistenthash.XXHash 以获得更均衡的分布
+	HashFn consistenthash.Hash
+	// KeyFn 从 key 中提取用于选择节点的部分，使相关的 key 落在同一个节点上，nil 表示使用完整的 key
+	KeyFn func(key string) string
+	// MaxConcurrentPeerRequests 限制同时发往远程节点的请求数，超出限制的请求会排队等待而不是失败，
+	// 避免 GetMulti 等批量请求同时向大量节点发起请求时耗尽文件描述符。0 表示不限制
+	MaxConcurrentPeerRequests int
+	// MaxIdleConnsPerHost 为每个远程节点保留的空闲连接数，0 表示使用默认值 64。
+	// http.DefaultTransport 只保留 2 个，并发访问同一节点时连接会被频繁地创建和关闭
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout 为空闲连接的最长保留时间，0 表示使用默认值 90s
+	IdleConnTimeout time.Duration
+	// MaxResponseBytes 为读取远程节点响应 body 的字节数上限，超出时返回 ErrResponseTooLarge，
+	// 避免异常的节点返回过大的 body 耗尽内存。0 表示使用默认值 64MB
+	MaxResponseBytes int64
+	// MaxRequestBytes 为服务端读取请求 body 的字节数上限，超出时返回 413。0 表示使用默认值 64MB
+	MaxRequestBytes int64
 }
 
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolWithOptions(self, HTTPPoolOptions{})
+}
+
+// NewHTTPPoolWithOptions creates a HTTPPool configured by opts.
+func NewHTTPPoolWithOptions(self string, opts HTTPPoolOptions) *HTTPPool {
+	if opts.Replicas <= 0 {
+		opts.Replicas = defaultReplicas
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = defaultMaxBodyBytes
+	}
+	if opts.MaxRequestBytes <= 0 {
+		opts.MaxRequestBytes = defaultMaxBodyBytes
+	}
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		client:   &http.Client{Timeout: defaultTimeout, Transport: newTransport(opts)},
+		opts:     opts,
+		logger:   noopLogger{},
+		tracer:   defaultTracer(),
+		codec:    ProtobufCodec{},
 	}
+	if opts.MaxConcurrentPeerRequests > 0 {
+		p.sem = make(chan struct{}, opts.MaxConcurrentPeerRequests)
+	}
+	return p
+}
+
+// newTransport 创建所有 httpGetter 共用的 Transport，复用到各个远程节点的连接。
+// 远程节点使用 https 时会尝试协商 HTTP/2，多个请求复用同一个连接
+func newTransport(opts HTTPPoolOptions) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0 // 不限制所有节点的空闲连接总数，只限制单个节点
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+	transport.ForceAttemptHTTP2 = true
+	return transport
+}
+
+// closeBody 读完并关闭响应，未读完的连接不会被放回连接池复用
+func closeBody(res *http.Response) {
+	// 只丢弃有限的剩余数据，过大的 body 直接关闭连接，而不是全部读完
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+	res.Body.Close()
+}
+
+// SetHTTPClient sets the client used to access remote peers.
+// 默认客户端的超时时间为 2s，并使用按照 HTTPPoolOptions 配置的共享 Transport，可以通过该方法替换为自定义的客户端，
+// 处理中的请求仍然使用原来的客户端
+func (p *HTTPPool) SetHTTPClient(client *http.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.client = client
+	p.refreshGettersLocked()
+}
+
+// SetBasePath sets the path prefix of the requests between peers, it must start and end with "/".
+// 同一主机上运行多个集群，或者通过反向代理按路径转发时，可以为每个集群设置不同的前缀。
+// 集群中所有节点需要使用相同的前缀，之后的请求都会使用新的前缀访问远程节点。
+func (p *HTTPPool) SetBasePath(path string) {
+	if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+		panic("HTTPPool base path must start and end with /: " + path)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.basePath = path
+	p.refreshGettersLocked()
 }
 
 // Log info with server name
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logger.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Start listens on addr and serves the requests from peers, it blocks until Shutdown is called.
+// Shutdown 被调用后 Start 立即返回 nil，此时处理中的请求可能尚未完成，调用方应等待 Shutdown 返回后再退出进程。
+func (p *HTTPPool) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve serves the requests from peers on l, see Start.
+func (p *HTTPPool) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.server != nil {
+		p.mu.Unlock()
+		l.Close()
+		return errors.New("HTTPPool is already serving")
+	}
+	server := &http.Server{Handler: p}
+	p.server = server
+	p.mu.Unlock()
+	if err := server.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the server started by Start, and stops the health checker.
+// 不再接受新的请求，等待处理中的请求完成后返回；ctx 先被取消时返回 ctx.Err()，未完成的请求会被中断
+func (p *HTTPPool) Shutdown(ctx context.Context) error {
+	p.StopHealthCheck()
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 首先判断访问路径的前缀是否是 basePath，不是返回错误。
-	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+	// 同一主机上可能运行着使用其他前缀的集群，因此返回 404 而不是 panic
+	p.mu.Lock()
+	basePath, tracer := p.basePath, p.tracer
+	p.mu.Unlock()
+	if !strings.HasPrefix(r.URL.Path, basePath) {
+		p.Log("serving unexpected path: %s", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	p.Log("%s %s", r.Method, r.URL.Path)
+	if r.URL.Path[len(basePath):] == healthPath {
+		w.WriteHeader(http.StatusOK)
+		return
 	}
-	p.Log(r.Method, r.URL.Path)
+	if r.URL.Path[len(basePath):] == statsPath {
+		p.serveStats(w, r)
+		return
+	}
+	ctx, span := startServerSpan(r.Context(), tracer, propagation.HeaderCarrier(r.Header))
+	defer span.End()
+	r = r.WithContext(ctx)
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			httpError(w, err)
+		} else {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	defer cancel()
+	r = r.WithContext(ctx)
 	// 我们约定访问路径格式为 /<basepath>/<groupname>/<key>，通过 groupname 得到 group 实例，
 	// 再使用 group.Get(key) 获取缓存数据。
-	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
+	parts, err := splitPath(r.URL.EscapedPath(), basePath)
+	if err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if parts[0] == batchPath {
+		p.serveMulti(w, r, parts[1])
+		return
+	}
+	if parts[0] == clearPath {
+		p.serveClear(w, r, parts[1])
+		return
+	}
+	if parts[0] == prefixPath {
+		p.serveDeletePrefix(w, r, parts[1])
+		return
+	}
+
+	in := &pb.Request{Group: parts[0], Key: parts[1], AcceptCompressed: r.Header.Get(acceptCompressedHeader) != ""}
+	switch r.Method {
+	case http.MethodDelete:
+		// 删除请求只作用于本节点，避免再次转发
+		err = ServeDelete(r.Context(), in)
+	case http.MethodHead:
+		// HEAD 请求只查询 key 是否已被缓存，200 表示存在，404 表示不存在，响应不携带缓存值
+		var exists bool
+		if exists, err = ServeHas(r.Context(), in); err == nil && !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case http.MethodPut, http.MethodPost:
+		// 写入请求的 body 为序列化后的 pb.Request，其中只有 value 与 version，同样只写入本节点
+		set := &pb.Request{}
+		if !p.readBody(w, r, set) {
+			return
+		}
+		in.Value, in.Version = set.Value, set.Version
+		err = ServeSet(r.Context(), in)
+	default:
+		codec, ok := p.responseCodec(r)
+		if !ok {
+			http.Error(w, "not acceptable: "+r.Header.Get("Accept"), http.StatusNotAcceptable)
+			return
+		}
+		out := &pb.Response{}
+		if err = ServeGet(r.Context(), in, out); err == nil {
+			p.writeMessage(w, codec, out)
+			return
+		}
+	}
+	if err != nil {
+		httpError(w, err)
+	}
+}
+
+// readBody 按照请求的 Content-Type 解码 body 到 v，失败时写入错误响应并返回 false
+func (p *HTTPPool) readBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	codec, ok := p.requestCodec(r)
+	if !ok {
+		http.Error(w, "unsupported media type: "+r.Header.Get("Content-Type"), http.StatusUnsupportedMediaType)
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, p.opts.MaxRequestBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err = codec.Unmarshal(body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// splitPath 将路径 <basepath><groupname>/<key> 切分为 groupname 和 key 并解码。
+// 客户端使用 base64（URL 安全、无填充）编码 groupname 和 key，任意二进制的 key（如包含 NUL 或非 UTF-8 字节）
+// 都可以无损地传递，编码后也不包含 /。_batch、_clear 等保留路径的 groupname 同样是编码后的。
+// 合法的 UTF-8 字符串编码后不会以 _ 开头，因此 group 不会与保留路径冲突
+func splitPath(escaped, basePath string) ([]string, error) {
+	if !strings.HasPrefix(escaped, basePath) {
+		return nil, fmt.Errorf("path must start with %s", basePath)
+	}
+	parts := strings.SplitN(escaped[len(basePath):], "/", 2)
 	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, errors.New("path must be <groupname>/<key>")
+	}
+	for i, part := range parts {
+		if i == 0 && (part == batchPath || part == clearPath || part == prefixPath) {
+			continue
+		}
+		decoded, err := decodeSegment(part)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = decoded
+	}
+	return parts, nil
+}
+
+func encodeSegment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeSegment(segment string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return "", fmt.Errorf("decoding path segment %q: %v", segment, err)
+	}
+	return string(b), nil
+}
+
+// serveMulti 处理批量获取请求，请求与响应的 body 分别为序列化后的 pb.MultiRequest 和 pb.MultiResponse
+func (p *HTTPPool) serveMulti(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	codec, ok := p.responseCodec(r)
+	if !ok {
+		http.Error(w, "not acceptable: "+r.Header.Get("Accept"), http.StatusNotAcceptable)
 		return
 	}
+	in := &pb.MultiRequest{}
+	if !p.readBody(w, r, in) {
+		return
+	}
+	in.Group = groupName
 
-	groupName := parts[0]
-	key := parts[1]
+	out := &pb.MultiResponse{}
+	if err := ServeGetMulti(r.Context(), in, out); err != nil {
+		httpError(w, err)
+		return
+	}
+	p.writeMessage(w, codec, out)
+}
+
+// serveClear 处理清空 group 的请求，只清空本节点
+func (p *HTTPPool) serveClear(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := ServeClear(r.Context(), &pb.Request{Group: groupName}); err != nil {
+		httpError(w, err)
+	}
+}
 
-	group := GetGroup(groupName)
-	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+// serveDeletePrefix 处理按前缀删除的请求，请求 body 为序列化后的 pb.Request，其中只有 key（即前缀），只删除本节点的缓存
+func (p *HTTPPool) serveDeletePrefix(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	codec, ok := p.responseCodec(r)
+	if !ok {
+		http.Error(w, "not acceptable: "+r.Header.Get("Accept"), http.StatusNotAcceptable)
+		return
+	}
+	in := &pb.Request{}
+	if !p.readBody(w, r, in) {
 		return
 	}
+	in.Group = groupName
 
-	view, err := group.Get(key)
+	n, err := ServeDeletePrefix(r.Context(), in)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, err)
 		return
 	}
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	p.writeMessage(w, codec, &pb.DeletePrefixResponse{Deleted: int64(n)})
+}
+
+func (p *HTTPPool) writeMessage(w http.ResponseWriter, codec Codec, v interface{}) {
+	body, err := codec.Marshal(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Type", codec.ContentType())
 	_, err = w.Write(body)
 }
 
+// httpError 将错误转换为对应的HTTP状态码
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, ErrNoSuchGroup) || errors.Is(err, ErrNotFound) {
+		code = http.StatusNotFound
+	} else if errors.Is(err, ErrValueTooLarge) {
+		code = http.StatusRequestEntityTooLarge
+	} else if errors.Is(err, ErrKeyTooLarge) {
+		code = http.StatusBadRequest
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), code)
+}
+
 // httpGetter 为HTTP客户端类
 type httpGetter struct {
 	baseURL string
+	client  *http.Client
+	sem     chan struct{} // 限制并发请求数的信号量，为 nil 时不限制
+	tracer  trace.Tracer
+	breaker *breaker // 为 nil 时不熔断
+	codec   Codec    // 为 nil 时使用 protobuf
+	retry   retryPolicy
+	// maxResponseBytes 为响应 body 的字节数上限，0 表示不限制
+	maxResponseBytes int64
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
+// acquire 获取信号量，直到响应读取完毕后才调用 release 释放，因为在此之前连接仍被占用。
+// 等待期间 ctx 被取消则返回 ctx.Err()
+func (h *httpGetter) acquire(ctx context.Context) (release func(), err error) {
+	if h.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case h.sem <- struct{}{}:
+		return func() { <-h.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// requestURL 拼接出访问远程节点的地址 <baseURL>/<groupname>/<key>
+func (h *httpGetter) requestURL(in *pb.Request) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.Group),
-		url.QueryEscape(in.Key),
+		encodeSegment(in.Group),
+		encodeSegment(in.Key),
 	)
-	res, err := http.Get(u)
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) (err error) {
+	ctx, span := h.tracer.Start(ctx, "dcache.httpGetter.Get", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrGroup.String(in.Group), attrKey.String(in.Key), attribute.String("dcache.peer.url", h.baseURL)))
+	defer func() { endSpan(span, err) }()
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		retryable, err = h.getOnce(ctx, in, out)
+		if err == nil || !retryable || !h.retry.wait(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// getOnce 向远程节点发送一次 Get 请求，retryable 表示失败是暂时性的，可以重试
+func (h *httpGetter) getOnce(ctx context.Context, in *pb.Request, out *pb.Response) (retryable bool, err error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.requestURL(in), nil)
+	if err != nil {
+		return false, err
+	}
+	// 通过 traceparent 请求头将 trace context 传递给远程节点
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Accept", h.getCodec().ContentType())
+	if in.AcceptCompressed {
+		req.Header.Set(acceptCompressedHeader, "1")
+	}
+	res, err := h.do(req)
+	if err != nil {
+		// 连接错误可以重试；熔断器打开或者请求被取消时重试没有意义
+		return !errors.Is(err, ErrCircuitOpen) && ctx.Err() == nil, err
+	}
+	defer closeBody(res)
+	if res.StatusCode == http.StatusNotFound {
+		// 远程节点返回 404，说明 key 不存在，还原为 ErrNotFound
+		return false, fmt.Errorf("%w: server returned: %v", ErrNotFound, res.Status)
+	}
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode >= http.StatusInternalServerError, fmt.Errorf("server returned: %v", res.Status)
+	}
+	bytes, err := h.readResponse(res)
+	if err != nil {
+		return false, err
+	}
+	if err = h.decodeResponse(res, bytes, out); err != nil {
+		return false, err
+	}
+	return false, VerifyChecksum(out)
+}
+
+func (h *httpGetter) Delete(ctx context.Context, in *pb.Request) error {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.requestURL(in), nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+func (h *httpGetter) Has(ctx context.Context, in *pb.Request) (bool, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, h.requestURL(in), nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := h.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer closeBody(res)
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		// key 未被缓存，或者远程节点上不存在该 group
+		return false, nil
+	}
+	return false, fmt.Errorf("server returned: %v", res.Status)
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request) error {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	// group 与 key 已经编码在路径中，body 只携带缓存值与版本号。
+	// proto3 的 string 字段要求合法的 UTF-8，二进制的 key 无法直接序列化
+	codec := h.getCodec()
+	body, err := codec.Marshal(&pb.Request{Value: in.Value, Version: in.Version})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.requestURL(in), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", codec.ContentType())
+	res, err := h.do(req)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	defer closeBody(res)
+	if res.StatusCode == http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%w: server returned: %v", ErrValueTooLarge, res.Status)
+	}
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("server returned: %v", res.Status)
 	}
-	bytes, err := io.ReadAll(res.Body)
+	return nil
+}
+
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	codec := h.getCodec()
+	body, err := codec.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, batchPath, encodeSegment(in.Group))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", codec.ContentType())
+	req.Header.Set("Accept", codec.ContentType())
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	body, err = h.readResponse(res)
+	if err != nil {
+		return err
+	}
+	return h.decodeResponse(res, body, out)
+}
+
+func (h *httpGetter) Clear(ctx context.Context, in *pb.Request) error {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, clearPath, encodeSegment(in.Group))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return err
+	}
+	res, err := h.do(req)
+	if err != nil {
+		return err
 	}
-	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("decoding reponse body: %v", err)
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
 	}
 	return nil
 }
 
+func (h *httpGetter) DeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	codec := h.getCodec()
+	body, err := codec.Marshal(&pb.Request{Key: in.Key})
+	if err != nil {
+		return 0, err
+	}
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, prefixPath, encodeSegment(in.Group))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", codec.ContentType())
+	req.Header.Set("Accept", codec.ContentType())
+	res, err := h.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server returned: %v", res.Status)
+	}
+	body, err = h.readResponse(res)
+	if err != nil {
+		return 0, err
+	}
+	out := &pb.DeletePrefixResponse{}
+	if err := h.decodeResponse(res, body, out); err != nil {
+		return 0, err
+	}
+	return int(out.Deleted), nil
+}
+
 // Set updates the pool's list of peers.
 // Set 方法实例化了一致性哈希算法，并且添加了传入的节点，并为每个节点创建了一个HTTP客户端 httpGetter
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers = p.newRing(len(peers))
 	p.peers.Add(peers...)
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	p.failures = make(map[string]int, len(peers))
+	p.unhealthy = make(map[string]bool)
+	for _, peer := range peers {
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+// newGetter 创建访问 peer 的 httpGetter，需要在持有 p.mu 时调用
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL:          peer + p.basePath,
+		client:           p.client,
+		sem:              p.sem,
+		tracer:           p.tracer,
+		breaker:          newBreaker(p.breakerFailures, p.breakerCooldown),
+		codec:            p.codec,
+		retry:            p.retry,
+		maxResponseBytes: p.opts.MaxResponseBytes,
+	}
+}
+
+// refreshGettersLocked 按照当前配置为每个节点重新创建 httpGetter 并替换 p.httpGetters，需要在持有 p.mu 时调用。
+// httpGetter 创建后不再修改，处理中的请求继续使用旧的 httpGetter，避免与配置的修改产生数据竞争；熔断器的状态保留给新的 httpGetter
+func (p *HTTPPool) refreshGettersLocked() {
+	getters := make(map[string]*httpGetter, len(p.httpGetters))
+	for peer, old := range p.httpGetters {
+		getter := p.newGetter(peer)
+		getter.breaker = old.breaker
+		getters[peer] = getter
+	}
+	p.httpGetters = getters
+}
+
+// newRing 按照 p.opts 创建一个空的哈希环，n 为将要加入的节点数，用于计算自适应的虚拟节点个数
+func (p *HTTPPool) newRing(n int) *consistenthash.Map {
+	ring := consistenthash.New(p.replicas(n), p.opts.HashFn)
+	ring.SetKeyFunc(p.opts.KeyFn)
+	return ring
+}
+
+// AddPeers adds peers to the pool incrementally.
+// 与 Set 不同，AddPeers 不会重建整个哈希环，只有新节点负责的那部分 key 会被重新映射，其他 key 的缓存不受影响
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = p.newRing(len(peers))
+		p.httpGetters = make(map[string]*httpGetter, len(peers))
+		p.failures = make(map[string]int, len(peers))
+		p.unhealthy = make(map[string]bool)
+	}
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.peers.Add(peer)
+		p.httpGetters[peer] = p.newGetter(peer)
 	}
+	p.resizeRing()
+}
+
+// RemovePeers removes peers from the pool incrementally.
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return
+	}
+	p.peers.Remove(peers...)
+	for _, peer := range peers {
+		delete(p.httpGetters, peer)
+		delete(p.failures, peer)
+		delete(p.unhealthy, peer)
+	}
+	p.resizeRing()
+}
+
+// Peers returns the clients of all remote peers, implements PeerLister.
+// 被健康检查移出哈希环的节点同样会被返回，保证广播请求不会遗漏节点
+func (p *HTTPPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if !p.isSelf(peer) {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+// OwnerOf returns the peer which the key is mapped to by the ring, it may be self.
+// 与 PickPeer 不同，OwnerOf 不会过滤掉本节点，用于排查 key 被路由到了哪个节点；未调用 Set 时返回空字符串
+func (p *HTTPPool) OwnerOf(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return ""
+	}
+	return p.peers.Get(key)
 }
 
 // PickPeer picks a peer according to key
 // PickPeer 包装了一致性哈希算法的 Get 方法，根据具体的key选择节点，返回节点对应的HTTP客户端
 // 返回true意味着将要从remote节点上获取数据。返回false意味着将要从本地获取数据
+// 启用读副本时，在哈希环上 key 之后的 readReplicas 个节点中随机选择一个
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+	if p.peers == nil {
+		return nil, false
+	}
+	if p.readReplicas > 1 {
+		replicas := p.peers.GetN(key, p.readReplicas)
+		if len(replicas) == 0 {
+			return nil, false
+		}
+		return p.getterLocked(replicas[rand.Intn(len(replicas))])
+	}
+	return p.getterLocked(p.peers.Get(key))
+}
+
+// getterLocked 返回访问 peer 的 httpGetter，peer 为空或者为本节点时返回 false，需要在持有 p.mu 时调用
+func (p *HTTPPool) getterLocked(peer string) (PeerGetter, bool) {
+	if peer == "" || p.isSelf(peer) {
+		return nil, false
 	}
-	return nil, false
+	p.Log("Pick peer %s", peer)
+	return p.httpGetters[peer], true
 }
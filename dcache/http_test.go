@@ -0,0 +1,1320 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // 模拟一个卡住的远程节点
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := NewHTTPPool("http://localhost:8001")
+	p.SetHTTPClient(&http.Client{Timeout: 20 * time.Millisecond})
+	p.Set(server.URL)
+	getter := p.httpGetters[server.URL]
+
+	start := time.Now()
+	err := getter.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if err == nil {
+		t.Fatalf("expect timeout error from a slow peer")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout should fire quickly, but took %v", elapsed)
+	}
+}
+
+func TestHTTPSet(t *testing.T) {
+	g := NewGroup("http-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	getter := p.httpGetters[server.URL]
+	in := &pb.Request{Group: "http-set", Key: "Tom", Value: []byte("630")}
+	if err := getter.Set(context.Background(), in); err != nil {
+		t.Fatalf("failed to set Tom: %v", err)
+	}
+	if view, ok := g.mainCache.get("Tom"); !ok || view.String() != "630" {
+		t.Fatalf("set over http should populate the serving node")
+	}
+
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "http-set", Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("failed to get Tom over http after set: %v", err)
+	}
+}
+
+func TestHTTPClear(t *testing.T) {
+	g := NewGroup("http-clear", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+	g.RegisterPeers(p)
+
+	g.populateCache("Tom", ByteView{b: []byte("630")})
+	getter := p.httpGetters[server.URL]
+	if err := getter.Clear(context.Background(), &pb.Request{Group: "http-clear"}); err != nil {
+		t.Fatalf("failed to clear over http: %v", err)
+	}
+	if keys := g.Keys(); len(keys) != 0 {
+		t.Fatalf("clear over http should empty the serving node, but got %v", keys)
+	}
+
+	// ClearAll 会清空本节点，并通过 PeerLister 广播给所有远程节点
+	g.populateCache("Jack", ByteView{b: []byte("589")})
+	if err := g.ClearAll(context.Background()); err != nil || len(g.Keys()) != 0 {
+		t.Fatalf("ClearAll failed: %v", err)
+	}
+	if err := getter.Clear(context.Background(), &pb.Request{Group: "unknown"}); err == nil {
+		t.Fatalf("clear unknown group should fail")
+	}
+}
+
+func TestHTTPDeletePrefix(t *testing.T) {
+	g := NewGroup("http-prefix", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	g.populateCache("user:1", ByteView{b: []byte("1")})
+	g.populateCache("user:2", ByteView{b: []byte("2")})
+	g.populateCache("order:1", ByteView{b: []byte("1")})
+	getter := p.httpGetters[server.URL]
+	n, err := getter.DeletePrefix(context.Background(), &pb.Request{Group: "http-prefix", Key: "user:"})
+	if err != nil || n != 2 {
+		t.Fatalf("expect 2 keys deleted over http, but got %d, %v", n, err)
+	}
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"order:1"}) {
+		t.Fatalf("unexpected keys after deleting prefix over http: %v", keys)
+	}
+	if _, err := getter.DeletePrefix(context.Background(), &pb.Request{Group: "unknown", Key: "user:"}); err == nil {
+		t.Fatalf("delete prefix in unknown group should fail")
+	}
+}
+
+func TestHTTPHas(t *testing.T) {
+	g := NewGroup("http-has", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	g.populateCache("Tom", ByteView{b: []byte("630")})
+	getter := p.httpGetters[server.URL]
+	for _, c := range []struct {
+		group, key string
+		exists     bool
+	}{
+		{"http-has", "Tom", true},
+		{"http-has", "Jack", false},
+		{"unknown", "Tom", false},
+	} {
+		exists, err := getter.Has(context.Background(), &pb.Request{Group: c.group, Key: c.key})
+		if err != nil || exists != c.exists {
+			t.Fatalf("Has(%s/%s) = %v, %v, expect %v", c.group, c.key, exists, err, c.exists)
+		}
+	}
+	if len(g.Keys()) != 1 {
+		t.Fatalf("HEAD should not load the key, but got %v", g.Keys())
+	}
+}
+
+func TestHTTPPoolOptions(t *testing.T) {
+	hashed := 0
+	p := NewHTTPPoolWithOptions("http://localhost:8001", HTTPPoolOptions{
+		Replicas: 3,
+		HashFn: func(data []byte) uint32 {
+			hashed++
+			return crc32.ChecksumIEEE(data)
+		},
+	})
+	p.Set("http://localhost:8001", "http://localhost:8002")
+	// 每个节点对应 3 个虚拟节点，哈希函数应被调用 2*3 次
+	if hashed != 6 {
+		t.Fatalf("expect 6 virtual nodes, but hash was called %d times", hashed)
+	}
+	if _, ok := p.PickPeer("Tom"); hashed != 7 {
+		t.Fatalf("PickPeer should use the custom hash, ok=%v", ok)
+	}
+
+	if p := NewHTTPPool("http://localhost:8001"); p.opts.Replicas != defaultReplicas {
+		t.Fatalf("default replicas should be %d, but got %d", defaultReplicas, p.opts.Replicas)
+	}
+}
+
+func TestAdaptiveReplicas(t *testing.T) {
+	cluster := func(n int) *HTTPPool {
+		peers := make([]string, n)
+		for i := range peers {
+			peers[i] = fmt.Sprintf("http://10.0.0.%d:8001", i)
+		}
+		p := NewHTTPPool(peers[0])
+		p.SetAdaptiveReplicas(true)
+		p.Set(peers...)
+		return p
+	}
+	// 每个节点分到的 key 数与平均值之比都在 [lo, hi] 之间
+	balanced := func(p *HTTPPool, n int, lo, hi float64) {
+		counts := make(map[string]int)
+		const keys = 100000
+		for i := 0; i < keys; i++ {
+			counts[p.OwnerOf(fmt.Sprintf("key%d", i))]++
+		}
+		mean := float64(keys) / float64(n)
+		if len(counts) != n {
+			t.Fatalf("expect keys on all %d nodes, but got %d", n, len(counts))
+		}
+		for peer, count := range counts {
+			if ratio := float64(count) / mean; ratio < lo || ratio > hi {
+				t.Fatalf("%d-node cluster is unbalanced: %s owns %.2f of the mean", n, peer, ratio)
+			}
+		}
+	}
+
+	small, large := cluster(2), cluster(100)
+	if small.peers.Replicas() <= large.peers.Replicas() {
+		t.Fatalf("expect more replicas for 2 nodes than for 100 nodes, but got %d and %d",
+			small.peers.Replicas(), large.peers.Replicas())
+	}
+	balanced(small, 2, 0.9, 1.1)
+	balanced(large, 100, 0.3, 2)
+
+	// AddPeers 按照新的节点数重新计算
+	small.AddPeers("http://10.0.0.100:8001", "http://10.0.0.101:8001")
+	if replicas := small.peers.Replicas(); replicas != adaptiveReplicas(4) || len(small.peers.Nodes()) != 4 {
+		t.Fatalf("expect %d replicas for 4 nodes, but got %d", adaptiveReplicas(4), replicas)
+	}
+	small.SetAdaptiveReplicas(false)
+	if replicas := small.peers.Replicas(); replicas != defaultReplicas {
+		t.Fatalf("expect the configured replicas after disabling, but got %d", replicas)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 异常的节点返回远超上限的 body
+		w.Write(bytes.Repeat([]byte("x"), 1<<20))
+	}))
+	defer server.Close()
+
+	p := NewHTTPPoolWithOptions("http://localhost:8001", HTTPPoolOptions{MaxResponseBytes: 1 << 10, MaxRequestBytes: 1 << 10})
+	p.Set(server.URL)
+	getter := p.httpGetters[server.URL]
+	err := getter.Get(context.Background(), &pb.Request{Group: "max-body", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expect %v, but got %v", ErrResponseTooLarge, err)
+	}
+
+	// 服务端同样限制请求 body 的大小
+	NewGroup("max-body", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	body, err := proto.Marshal(&pb.Request{Value: bytes.Repeat([]byte("x"), 2<<10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPut, defaultBasePath+encodeSegment("max-body")+"/"+encodeSegment("Tom"), bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 for an oversized request body, but got %d", rec.Code)
+	}
+}
+
+func TestMaxConcurrentPeerRequests(t *testing.T) {
+	var running, maxRunning int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			max := atomic.LoadInt64(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt64(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&running, -1)
+	}))
+	defer server.Close()
+
+	p := NewHTTPPoolWithOptions("http://localhost:8001", HTTPPoolOptions{MaxConcurrentPeerRequests: 2})
+	p.Set(server.URL)
+	getter := p.httpGetters[server.URL]
+
+	// 超出限制的请求排队等待，而不是失败
+	var wg sync.WaitGroup
+	var failed int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			in := &pb.Request{Group: "concurrent", Key: strconv.Itoa(i)}
+			if err := getter.Get(context.Background(), in, &pb.Response{}); err != nil {
+				atomic.AddInt64(&failed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if failed != 0 {
+		t.Fatalf("requests over the limit should wait, but %d failed", failed)
+	}
+	if maxRunning > 2 {
+		t.Fatalf("expect at most 2 concurrent peer requests, but got %d", maxRunning)
+	}
+}
+
+func TestSetBasePath(t *testing.T) {
+	NewGroup("base-path", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	p.SetBasePath("/cluster-a/")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	getter := p.httpGetters[server.URL]
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "base-path", Key: "Tom"}, out); err != nil || string(out.Value) != "Tom" {
+		t.Fatalf("failed to get Tom with base path /cluster-a/: %v", err)
+	}
+
+	res, err := http.Get(server.URL + "/cluster-b/base-path/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("requests to another base path should be rejected, but got %v", res.Status)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("base path without trailing slash should panic")
+		}
+	}()
+	p.SetBasePath("/cluster-a")
+}
+
+func TestReconfigureConcurrent(t *testing.T) {
+	NewGroup("reconfigure-concurrent", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	// 请求进行中修改前缀、客户端、编码、重试策略或 TracerProvider 不会产生数据竞争，使用 go test -race 检查
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			peer, _ := p.PickPeer("Tom")
+			peer.Get(context.Background(), &pb.Request{Group: "reconfigure-concurrent", Key: "Tom"}, &pb.Response{})
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			p.SetBasePath(defaultBasePath)
+			p.SetHTTPClient(&http.Client{Timeout: defaultTimeout})
+			p.SetCodec(ProtobufCodec{})
+			p.SetPeerRetry(1, 0)
+			p.SetTracerProvider(nil)
+			runtime.Gosched()
+		}
+	}
+
+	peer, _ := p.PickPeer("Tom")
+	out := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "reconfigure-concurrent", Key: "Tom"}, out); err != nil || string(out.Value) != "Tom" {
+		t.Fatalf("failed to get Tom after reconfiguring: %v", err)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	g := NewGroup("http-stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set("http://localhost:8001", "http://localhost:8002")
+
+	_, _ = g.getLocally(context.Background(), "Tom")
+	_, _, _ = g.get(context.Background(), "Tom", false)
+
+	res, err := http.Get(server.URL + defaultBasePath + statsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var stats PoolStats
+	if err = json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if expect := []string{"http://localhost:8001", "http://localhost:8002"}; !reflect.DeepEqual(expect, stats.Peers) {
+		t.Fatalf("expect peers %v, but got %v", expect, stats.Peers)
+	}
+	expect := GroupStats{
+		Stats:    Stats{LocalHits: 1, Loads: 1},
+		Entries:  1,
+		Bytes:    int64(len("Tom") + len(db["Tom"])),
+		MaxBytes: 2 << 10,
+	}
+	if got := stats.Groups["http-stats"]; got != expect {
+		t.Fatalf("expect group stats %+v, but got %+v", expect, got)
+	}
+}
+
+func TestHTTPGetMulti(t *testing.T) {
+	NewGroup("http-multi", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+
+	getter := p.httpGetters[server.URL]
+	out := &pb.MultiResponse{}
+	in := &pb.MultiRequest{Group: "http-multi", Keys: []string{"Tom", "Jack", "unknown"}}
+	if err := getter.GetMulti(context.Background(), in, out); err != nil {
+		t.Fatalf("failed to get multi over http: %v", err)
+	}
+	if string(out.Values["Tom"]) != "630" || string(out.Values["Jack"]) != "589" {
+		t.Fatalf("unexpected values %v", out.Values)
+	}
+	if _, ok := out.Errors["unknown"]; !ok || len(out.Errors) != 1 {
+		t.Fatalf("expect unknown to be reported as failed, but got %v", out.Errors)
+	}
+}
+
+func TestPeerErrorFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	g := NewGroup("peer-error", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set(server.URL) // 所有 key 都归属于一直返回 500 的远程节点
+	g.RegisterPeers(p)
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect Tom to fall back to local getter, but got %q, %v", view.String(), err)
+	}
+
+	// 关闭回退后，远程节点的错误直接返回给调用方，不会访问数据源
+	loads := g.Stats().Loads
+	g.SetFallbackLocal(false)
+	if _, err := g.Get("Jack"); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expect the peer error, but got %v", err)
+	}
+	_, err := g.GetMulti([]string{"Jack", "Sam"})
+	failed, ok := err.(MultiError)
+	if !ok || len(failed) != 2 || !strings.Contains(failed["Sam"].Error(), "500") {
+		t.Fatalf("expect the peer error for every key in GetMulti, but got %v", err)
+	}
+	if g.Stats().Loads != loads {
+		t.Fatalf("getter should not be called when fallback is disabled")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	body, err := proto.Marshal(&pb.Response{Value: []byte("peer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int64
+	var failing atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		if failing.Load() {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	g := NewGroup("circuit-breaker", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set(server.URL) // 所有 key 都归属于远程节点
+	p.SetCircuitBreaker(3, 50*time.Millisecond)
+	g.RegisterPeers(p)
+
+	get := func(key string) (string, Source) {
+		view, source, err := g.GetWithSource(key)
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", key, err)
+		}
+		return view.String(), source
+	}
+	// 连续失败 3 次后熔断器打开，之后的请求不再访问远程节点，直接回退到本地
+	for i := 0; i < 6; i++ {
+		if v, source := get("fail-" + strconv.Itoa(i)); v != "local" || source != SourceGetter {
+			t.Fatalf("expect to fall back to local getter, but got %q from %v", v, source)
+		}
+	}
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Fatalf("expect the breaker to open after 3 failures, but the peer was called %d times", n)
+	}
+
+	// cooldown 之后放行一个探测请求，成功后熔断器关闭
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if v, source := get("recover-" + strconv.Itoa(i)); v != "peer" || source != SourcePeer {
+			t.Fatalf("expect the breaker to recover, but got %q from %v", v, source)
+		}
+	}
+	if n := atomic.LoadInt64(&calls); n != 5 {
+		t.Fatalf("expect 2 more peer calls after recovery, but got %d in total", n)
+	}
+}
+
+func TestHTTPChecksum(t *testing.T) {
+	body, err := proto.Marshal(&pb.Response{Value: []byte("630"), Checksum: crc32.ChecksumIEEE([]byte("630"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corrupt atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := body
+		if corrupt.Load() {
+			// 模拟传输过程中被翻转的一个字节
+			b = bytes.Replace(body, []byte("630"), []byte("631"), 1)
+		}
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	out := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("expect 630, but got %q, %v", out.Value, err)
+	}
+	corrupt.Store(true)
+	err = getter.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expect ErrChecksumMismatch, but got %v", err)
+	}
+}
+
+func TestHTTPPoolShutdown(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	NewGroup("shutdown", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		close(loading)
+		<-release // 模拟一个处理中的慢请求
+		return []byte("630"), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewHTTPPool("http://" + l.Addr().String())
+	served := make(chan error, 1)
+	go func() { served <- p.Serve(l) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String() + defaultBasePath + encodeSegment("shutdown") + "/" + encodeSegment("Tom"))
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		out := &pb.Response{}
+		body, _ := io.ReadAll(res.Body)
+		err = proto.Unmarshal(body, out)
+		got <- result{body: string(out.Value), err: err}
+	}()
+	<-loading
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- p.Shutdown(context.Background()) }()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve should return nil after Shutdown, but got %v", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the in-flight request completed", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if r := <-got; r.err != nil || r.body != "630" {
+		t.Fatalf("in-flight request should complete, but got %q, %v", r.body, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown should drain cleanly, but got %v", err)
+	}
+	if _, err := http.Get("http://" + l.Addr().String() + defaultBasePath + encodeSegment("shutdown") + "/" + encodeSegment("Tom")); err == nil {
+		t.Fatalf("expect new requests to be refused after Shutdown")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	// 同一个进程中的 Group 是全局共享的，调用方与远程节点使用同一个 Group
+	g := NewGroup("tracing", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.SetTracerProvider(tp)
+	remote := NewHTTPPool("http://localhost:8002")
+	remote.SetTracerProvider(tp)
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	p := NewHTTPPool("http://localhost:8001")
+	p.SetTracerProvider(tp)
+	p.Set(server.URL)
+	g.RegisterPeers(p)
+
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect 630, but got %q, %v", view.String(), err)
+	}
+
+	// 期望的 span 层级，远程节点的 span 通过 traceparent 请求头挂在调用方的 span 下
+	spans := exporter.GetSpans()
+	expect := []string{
+		"dcache.Group.Get", "dcache.Group.load", "dcache.httpGetter.Get",
+		"dcache.HTTPPool.ServeHTTP", "dcache.Group.Get", "dcache.Group.getLocally",
+	}
+	if len(spans) != len(expect) {
+		t.Fatalf("expect %d spans, but got %d", len(expect), len(spans))
+	}
+	byID := make(map[trace.SpanID]tracetest.SpanStub, len(spans))
+	var leaf tracetest.SpanStub
+	for _, span := range spans {
+		byID[span.SpanContext.SpanID()] = span
+		if span.Name == "dcache.Group.getLocally" {
+			leaf = span
+		}
+	}
+	chain := []string{leaf.Name}
+	for span := leaf; span.Parent.IsValid(); {
+		span = byID[span.Parent.SpanID()]
+		chain = append([]string{span.Name}, chain...)
+		if span.SpanContext.TraceID() != leaf.SpanContext.TraceID() {
+			t.Fatalf("span %s is not in the same trace", span.Name)
+		}
+	}
+	if !reflect.DeepEqual(chain, expect) {
+		t.Fatalf("expect span hierarchy %v, but got %v", expect, chain)
+	}
+	for _, span := range spans {
+		if span.Name == "dcache.Group.load" && !hasAttr(span.Attributes, attrPeer.Bool(true)) {
+			t.Fatalf("load span should be marked as a peer fetch, got %v", span.Attributes)
+		}
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, kv attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+// newCountingServer 创建一个总是返回 630 的远程节点，conns 记录其接受的连接数
+func newCountingServer(conns *int64) *httptest.Server {
+	body, _ := proto.Marshal(&pb.Response{Value: []byte("630")})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(conns, 1)
+		}
+	}
+	server.Start()
+	return server
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var conns int64
+	server := newCountingServer(&conns)
+	defer server.Close()
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set(server.URL)
+	getter := p.httpGetters[server.URL]
+
+	const workers = 8
+	for round := 0; round < 5; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := getter.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	// 每个并发请求最多占用一个连接，一批请求结束后空闲连接被保留，下一批请求复用这些连接
+	if n := atomic.LoadInt64(&conns); n > workers {
+		t.Fatalf("expect at most %d connections, but got %d", workers, n)
+	}
+}
+
+func BenchmarkPeerConnections(b *testing.B) {
+	for name, client := range map[string]*http.Client{
+		"DefaultTransport": {Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		"PooledTransport":  {Transport: newTransport(HTTPPoolOptions{MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost, IdleConnTimeout: defaultIdleConnTimeout})},
+	} {
+		b.Run(name, func(b *testing.B) {
+			var conns int64
+			server := newCountingServer(&conns)
+			defer server.Close()
+			getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: client, tracer: defaultTracer()}
+			// 每次迭代并发发出一批请求，批次之间超出 MaxIdleConnsPerHost 的空闲连接会被关闭，下一批需要重新建立连接
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < 16; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						getter.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
+
+func TestHTTPKeyEscaping(t *testing.T) {
+	// 回调函数直接返回 key，从而验证远程节点收到的 key 与客户端发送的一致
+	NewGroup("escaping/group", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer server.Close()
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	for _, key := range []string{"dir/sub/file.txt", "a b+c%d", "/leading/", "?x=1#frag"} {
+		out := &pb.Response{}
+		if err := getter.Get(context.Background(), &pb.Request{Group: "escaping/group", Key: key}, out); err != nil || string(out.Value) != key {
+			t.Fatalf("expect key %q to round-trip, but got %q, %v", key, out.Value, err)
+		}
+	}
+}
+
+func TestSelfMatcher(t *testing.T) {
+	g := NewGroup("self-matcher", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set("http://127.0.0.1:8001") // 服务发现返回的是同一个节点的另一个地址
+	g.RegisterPeers(p)
+	if _, ok := p.PickPeer("Tom"); !ok {
+		t.Fatalf("expect exact matching not to recognize the aliased self address")
+	}
+
+	p.SetSelfMatcher(SameAddr)
+	if peer, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("expect Tom to be served locally, but picked %v", peer)
+	}
+	if view, source, err := g.GetWithSource("Tom"); err != nil || view.String() != "630" || source != SourceGetter {
+		t.Fatalf("expect Tom to be loaded locally, but got %q from %v, %v", view.String(), source, err)
+	}
+	if len(p.Peers()) != 0 {
+		t.Fatalf("expect self to be excluded from Peers")
+	}
+}
+
+func TestReadReplicas(t *testing.T) {
+	body, err := proto.Marshal(&pb.Response{Value: []byte("630")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gets, sets := make(map[string]*int64), make(map[string]*int64)
+	var peers []string
+	for i := 0; i < 3; i++ {
+		var get, set int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				atomic.AddInt64(&set, 1)
+				return
+			}
+			atomic.AddInt64(&get, 1)
+			w.Write(body)
+		}))
+		defer server.Close()
+		peers = append(peers, server.URL)
+		gets[server.URL], sets[server.URL] = &get, &set
+	}
+
+	g := NewGroup("read-replicas", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	p := NewHTTPPool("http://localhost:8001") // 本节点不在哈希环中，所有请求都发往远程节点
+	p.Set(peers...)
+	p.SetReadReplicas(3)
+	g.RegisterPeers(p)
+
+	// 读请求分摊到 3 个副本上
+	for i := 0; i < 60; i++ {
+		if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("failed to get Tom: %v", err)
+		}
+	}
+	for peer, n := range gets {
+		if *n == 0 {
+			t.Fatalf("expect reads to be spread across replicas, but %s got none: %v", peer, gets)
+		}
+	}
+
+	// 写请求始终发往主节点
+	for i := 0; i < 10; i++ {
+		if err := g.Set("Tom", []byte("631")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary := p.OwnerOf("Tom")
+	for peer, n := range sets {
+		if expect := map[bool]int64{true: 10, false: 0}[peer == primary]; *n != expect {
+			t.Fatalf("expect %d sets on %s (primary %s), but got %d", expect, peer, primary, *n)
+		}
+	}
+}
+
+func TestSameAddr(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		same bool
+	}{
+		{"http://localhost:8001", "http://127.0.0.1:8001", true},
+		{"http://[::1]:8001", "http://localhost:8001", true},
+		{"http://example.com", "http://example.com:80", true},
+		{"http://localhost:8001", "http://127.0.0.1:8002", false},
+		{"http://localhost:8001", "https://localhost:8001", false},
+		{"http://10.0.0.1:8001", "http://127.0.0.1:8001", false},
+	} {
+		if got := SameAddr(c.a, c.b); got != c.same {
+			t.Errorf("SameAddr(%s, %s) = %v, expect %v", c.a, c.b, got, c.same)
+		}
+	}
+}
+
+func TestHTTPKeyTooLarge(t *testing.T) {
+	NewGroup("http-key-too-large", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer server.Close()
+
+	u := server.URL + defaultBasePath + encodeSegment("http-key-too-large") + "/" + encodeSegment(strings.Repeat("k", defaultMaxKeyBytes+1))
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req, _ := http.NewRequest(method, u, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s over-length key: expect 400, but got %v", method, res.Status)
+		}
+	}
+}
+
+func TestHTTPBinaryKeys(t *testing.T) {
+	g := NewGroup("binary-keys", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer server.Close()
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	ctx := context.Background()
+	key := "\x00\xff\xfe/\x80bin\x00"
+	out := &pb.Response{}
+	if err := getter.Get(ctx, &pb.Request{Group: "binary-keys", Key: key}, out); err != nil || string(out.Value) != key {
+		t.Fatalf("expect binary key %q to round-trip, but got %q, %v", key, out.Value, err)
+	}
+
+	// 写入、查询与删除同样可以使用二进制的 key
+	key2 := "\x01\x00\x9c"
+	if err := getter.Set(ctx, &pb.Request{Group: "binary-keys", Key: key2, Value: []byte("630"), Version: 1}); err != nil {
+		t.Fatalf("failed to set binary key: %v", err)
+	}
+	if v, ok := g.mainCache.get(key2); !ok || v.String() != "630" || v.version != 1 {
+		t.Fatalf("expect binary key %q to be set with its version, but got %q, %d", key2, v.String(), v.version)
+	}
+	if exists, err := getter.Has(ctx, &pb.Request{Group: "binary-keys", Key: key2}); err != nil || !exists {
+		t.Fatalf("expect binary key %q to exist: %v", key2, err)
+	}
+	if err := getter.Delete(ctx, &pb.Request{Group: "binary-keys", Key: key2}); err != nil {
+		t.Fatalf("failed to delete binary key: %v", err)
+	}
+	if g.hasLocally(key2) {
+		t.Fatalf("expect binary key %q to be deleted", key2)
+	}
+}
+
+func TestOwnerOf(t *testing.T) {
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self)
+	if p.OwnerOf("Tom") != "" {
+		t.Fatalf("expect no owner before Set")
+	}
+	peers := []string{self, "http://localhost:8002", "http://localhost:8003"}
+	p.Set(peers...)
+	var local, remote int
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		owner := p.OwnerOf(key)
+		peer, ok := p.PickPeer(key)
+		if owner == self {
+			local++
+			if ok {
+				t.Fatalf("key %s is owned by self, but PickPeer picked %v", key, peer)
+			}
+			continue
+		}
+		remote++
+		if !ok || peer != PeerGetter(p.httpGetters[owner]) {
+			t.Fatalf("key %s is owned by %s, but PickPeer picked %v", key, owner, peer)
+		}
+	}
+	if local == 0 || remote == 0 {
+		t.Fatalf("expect keys on both self and remote peers, got %d local and %d remote", local, remote)
+	}
+}
+
+func TestSingleflightScope(t *testing.T) {
+	// 所有 key 都归属于远程节点，而远程节点就是本进程中的同一个 Group：
+	// 远程节点的本地加载不能与调用方正在进行的远程获取合并，否则双方互相等待直到超时
+	g := NewGroup("sf-scope", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://localhost:8002"))
+	defer server.Close()
+	p := NewHTTPPool("http://localhost:8001")
+	p.SetHTTPClient(&http.Client{Timeout: time.Second})
+	p.Set(server.URL)
+	g.RegisterPeers(p)
+
+	view, source, err := g.GetWithSource("Tom")
+	if err != nil || view.String() != "630" || source != SourcePeer {
+		t.Fatalf("expect 630 from peer, but got %q from %v, %v", view.String(), source, err)
+	}
+}
+
+func TestHTTPNotFound(t *testing.T) {
+	NewGroup("http-not-found", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "outage" {
+			return nil, fmt.Errorf("database is down")
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	// 服务端：ErrNotFound 映射为 404，其他错误映射为 500
+	for key, code := range map[string]int{"Tom": http.StatusNotFound, "outage": http.StatusInternalServerError} {
+		res, err := http.Get(server.URL + defaultBasePath + encodeSegment("http-not-found") + "/" + encodeSegment(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != code {
+			t.Fatalf("expect status %d for %s, but got %d", code, key, res.StatusCode)
+		}
+	}
+
+	// 客户端：404 还原为 ErrNotFound
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	err := getter.Get(context.Background(), &pb.Request{Group: "http-not-found", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+	err = getter.Get(context.Background(), &pb.Request{Group: "http-not-found", Key: "outage"}, &pb.Response{})
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect a backend error, but got %v", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	var down int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+	healthy := httptest.NewServer(NewHTTPPool("http://localhost:8002"))
+	defer healthy.Close()
+
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self)
+	p.Set(self, healthy.URL, flaky.URL)
+	p.StartHealthCheck(5 * time.Millisecond)
+	defer p.StopHealthCheck()
+
+	waitFor := func(expect []string) {
+		deadline := time.Now().Add(time.Second)
+		for !reflect.DeepEqual(p.HealthyPeers(), expect) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect healthy peers %v, but got %v", expect, p.HealthyPeers())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	atomic.StoreInt32(&down, 1)
+	all := []string{self, healthy.URL, flaky.URL}
+	sort.Strings(all)
+	alive := []string{self, healthy.URL}
+	sort.Strings(alive)
+	waitFor(alive)
+	for i := 0; i < 100; i++ {
+		if peer, ok := p.PickPeer(strconv.Itoa(i)); ok && peer == PeerGetter(p.httpGetters[flaky.URL]) {
+			t.Fatalf("unhealthy peer should not be picked")
+		}
+	}
+
+	atomic.StoreInt32(&down, 0)
+	waitFor(all)
+}
+
+func TestHealthCheckInvalidInterval(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("non-positive interval should panic")
+			}
+		}()
+		p.StartHealthCheck(0)
+	}()
+	// panic 之后没有留下后台 goroutine，仍然可以正常启动健康检查
+	if p.stopHealth != nil {
+		t.Fatalf("invalid interval should not start the health checker")
+	}
+	p.StartHealthCheck(time.Millisecond)
+	p.StopHealthCheck()
+}
+
+func TestAddRemovePeers(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+
+	const n = 10000
+	before := make([]string, n)
+	for i := range before {
+		before[i] = p.peers.Get(strconv.Itoa(i))
+	}
+
+	p.AddPeers("http://localhost:8004")
+	moved := 0
+	for i := range before {
+		owner := p.peers.Get(strconv.Itoa(i))
+		if owner == before[i] {
+			continue
+		}
+		if owner != "http://localhost:8004" {
+			t.Fatalf("key %d should only move to the new peer, but moved to %s", i, owner)
+		}
+		moved++
+	}
+	// 新节点理论上负责 1/4 的 key
+	if moved < n/8 || moved > n*3/8 {
+		t.Fatalf("expect about %d keys to be remapped, but got %d", n/4, moved)
+	}
+
+	p.RemovePeers("http://localhost:8004")
+	for i := range before {
+		if owner := p.peers.Get(strconv.Itoa(i)); owner != before[i] {
+			t.Fatalf("key %d should move back to %s after removal, but got %s", i, before[i], owner)
+		}
+	}
+	if _, ok := p.httpGetters["http://localhost:8004"]; ok {
+		t.Fatalf("removed peer should not keep its httpGetter")
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	value := []byte(strings.Repeat(`{"name":"Tom","score":630},`, 400))
+	g := NewGroup("http-compression", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	}))
+	g.SetCompression(1024)
+	p := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(p)
+	defer server.Close()
+	p.Set(server.URL)
+	getter := p.httpGetters[server.URL]
+
+	// 支持压缩的客户端收到压缩后的数据
+	out := &pb.Response{}
+	in := &pb.Request{Group: "http-compression", Key: "Tom", AcceptCompressed: true}
+	if err := getter.Get(context.Background(), in, out); err != nil || !out.Compressed || len(out.Value) >= len(value) {
+		t.Fatalf("expect a compressed payload, but got %d bytes, %v", len(out.Value), err)
+	}
+	if view, err := g.GetFromPeer(context.Background(), getter, "Tom"); err != nil || !bytes.Equal(view.ByteSlice(), value) {
+		t.Fatalf("failed to decompress the value from peer: %v", err)
+	}
+
+	// 不支持压缩的客户端收到原始数据
+	out = &pb.Response{}
+	in.AcceptCompressed = false
+	if err := getter.Get(context.Background(), in, out); err != nil || out.Compressed || !bytes.Equal(out.Value, value) {
+		t.Fatalf("expect a raw payload for clients without compression support: %v", err)
+	}
+}
+
+// jsonCodec 使用 encoding/json 编码节点间的消息
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func TestHTTPCodec(t *testing.T) {
+	g := NewGroup("json-codec", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	serverPool := NewHTTPPool("http://localhost:8001")
+	serverPool.SetCodec(jsonCodec{})
+	var mu sync.Mutex
+	var contentTypes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type")+"|"+r.Header.Get("Accept"))
+		mu.Unlock()
+		serverPool.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	clientPool := NewHTTPPool("http://localhost:8002")
+	clientPool.SetCodec(jsonCodec{})
+	clientPool.Set(server.URL)
+	peer, ok := clientPool.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("expect to pick the remote peer")
+	}
+	ctx := context.Background()
+	out := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "json-codec", Key: "Tom"}, out); err != nil || string(out.Value) != "value of Tom" {
+		t.Fatalf("failed to get with json codec: %q, %v", out.Value, err)
+	}
+	if err := peer.Set(ctx, &pb.Request{Group: "json-codec", Key: "Jack", Value: []byte("589"), Version: 3}); err != nil {
+		t.Fatalf("failed to set with json codec: %v", err)
+	}
+	if v, ok := g.mainCache.get("Jack"); !ok || v.String() != "589" || v.version != 3 {
+		t.Fatalf("expect Jack to be set with its version, but got %q, %d", v.String(), v.version)
+	}
+	multi := &pb.MultiResponse{}
+	if err := peer.GetMulti(ctx, &pb.MultiRequest{Group: "json-codec", Keys: []string{"Tom", "Jack"}}, multi); err != nil {
+		t.Fatalf("failed to get multi with json codec: %v", err)
+	}
+	if len(multi.Values) != 2 || string(multi.Values["Jack"]) != "589" {
+		t.Fatalf("unexpected multi response: %v", multi.Values)
+	}
+	mu.Lock()
+	for _, ct := range contentTypes {
+		if !strings.Contains(ct, "application/json") {
+			t.Fatalf("expect every request to negotiate json, but got %q", ct)
+		}
+	}
+	mu.Unlock()
+
+	// 服务端仍然接受默认的 protobuf 编码
+	protoGetter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	out = &pb.Response{}
+	if err := protoGetter.Get(ctx, &pb.Request{Group: "json-codec", Key: "Sam"}, out); err != nil || string(out.Value) != "value of Sam" {
+		t.Fatalf("expect a json server to serve protobuf clients: %q, %v", out.Value, err)
+	}
+
+	// 服务端不支持客户端的编码时请求失败，而不是按照错误的编码解析
+	protoServer := httptest.NewServer(NewHTTPPool("http://localhost:8003"))
+	defer protoServer.Close()
+	jsonGetter := &httpGetter{baseURL: protoServer.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer(), codec: jsonCodec{}}
+	if err := jsonGetter.Get(ctx, &pb.Request{Group: "json-codec", Key: "Tom"}, &pb.Response{}); err == nil || !strings.Contains(err.Error(), "406") {
+		t.Fatalf("expect 406 from a server without the json codec, but got %v", err)
+	}
+	if err := jsonGetter.Set(ctx, &pb.Request{Group: "json-codec", Key: "Tom", Value: []byte("1")}); err == nil || !strings.Contains(err.Error(), "415") {
+		t.Fatalf("expect 415 from a server without the json codec, but got %v", err)
+	}
+}
+
+func TestPeerRetry(t *testing.T) {
+	body, err := proto.Marshal(&pb.Response{Value: []byte("peer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&calls, 1)
+		if strings.HasSuffix(r.URL.Path, "/"+encodeSegment("missing")) {
+			http.NotFound(w, r)
+			return
+		}
+		if n == 1 {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	var loads int64
+	g := NewGroup("peer-retry", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt64(&loads, 1)
+		return []byte("local"), nil
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set(server.URL) // 所有 key 都归属于远程节点
+	p.SetPeerRetry(3, time.Millisecond)
+	g.RegisterPeers(p)
+
+	// 第一次请求失败后重试成功，不会回退到本地
+	view, source, err := g.GetWithSource("Tom")
+	if err != nil || view.String() != "peer" || source != SourcePeer {
+		t.Fatalf("expect the retry to succeed, but got %q from %v, %v", view.String(), source, err)
+	}
+	if n := atomic.LoadInt64(&calls); n != 2 {
+		t.Fatalf("expect 2 peer calls, but got %d", n)
+	}
+	if n := atomic.LoadInt64(&loads); n != 0 {
+		t.Fatalf("expect no local fallback, but the getter was called %d times", n)
+	}
+
+	// 404 不会重试
+	atomic.StoreInt64(&calls, 0)
+	peer, _ := p.PickPeer("missing")
+	if err := peer.Get(context.Background(), &pb.Request{Group: "peer-retry", Key: "missing"}, &pb.Response{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("expect 404 not to be retried, but the peer was called %d times", n)
+	}
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	var calls int64
+	aborted := make(chan error, 1)
+	NewGroup("deadline", 2<<10, GetterContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&calls, 1)
+		select {
+		case <-ctx.Done():
+			aborted <- ctx.Err()
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+			return []byte(key), nil
+		}
+	}))
+	p := NewHTTPPool("http://localhost:8001")
+	var header atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header.Store(r.Header.Get(timeoutHeader))
+		p.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// 客户端通过请求头传递剩余时间
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath, client: http.DefaultClient, tracer: defaultTracer()}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go getter.Get(ctx, &pb.Request{Group: "deadline", Key: "Tom"}, &pb.Response{})
+	<-aborted
+	if ms, err := strconv.Atoi(header.Load().(string)); err != nil || ms <= 0 || ms > 200 {
+		t.Fatalf("expect the remaining budget in the header, but got %q", header.Load())
+	}
+
+	// 服务端按照请求头的截止时间中止加载，而不是等待回调函数返回
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+encodeSegment("deadline")+"/"+encodeSegment("Jack"), nil)
+	req.Header.Set(timeoutHeader, "50")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expect 504, but got %d", rec.Code)
+	}
+	if err := <-aborted; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the getter to be aborted by the deadline, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect an early abort, but took %v", elapsed)
+	}
+
+	// 剩余时间不足时不再调用回调函数
+	atomic.StoreInt64(&calls, 0)
+	req = httptest.NewRequest(http.MethodGet, defaultBasePath+encodeSegment("deadline")+"/"+encodeSegment("Sam"), nil)
+	req.Header.Set(timeoutHeader, "1")
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout || atomic.LoadInt64(&calls) != 0 {
+		t.Fatalf("expect 504 without calling the getter, but got %d after %d calls", rec.Code, calls)
+	}
+}
@@ -0,0 +1,26 @@
+package dcache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// 过期时间抖动：预热或同一时刻加载的大量 key 如果使用相同的过期时间，会在同一时刻一起过期，瞬间压垮数据源。
+// 写入缓存时将过期时间随机地延长或缩短最多 fraction 比例，使过期时间分散开。
+
+// SetTTLJitter randomizes the ttl of each entry by up to ±fraction of the ttl, 0 disables jitter.
+// fraction 必须在 [0, 1) 范围内，例如 0.1 表示 10 分钟的 ttl 实际在 9 到 11 分钟之间随机过期
+func (g *Group) SetTTLJitter(fraction float64) {
+	if fraction < 0 || fraction >= 1 {
+		panic("ttl jitter must be in [0, 1)")
+	}
+	g.ttlJitter = fraction
+}
+
+// jitter 返回抖动后的 ttl，ttl <= 0（永不过期）时原样返回
+func (g *Group) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || g.ttlJitter == 0 {
+		return ttl
+	}
+	return ttl + time.Duration(float64(ttl)*g.ttlJitter*(2*rand.Float64()-1))
+}
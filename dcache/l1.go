@@ -0,0 +1,40 @@
+package dcache
+
+import "time"
+
+// 两级缓存：mainCache 只缓存归属于本节点的 key（L2，由所有节点共同组成），
+// 归属于远程节点的热点 key 每次读取都需要一次网络请求。启用 L1 后，从远程节点获取成功的值
+// 会在本节点一个较小的 LRU 中缓存 ttl 时间，ttl 内的重复读取不再访问远程节点。
+// L1 中的值可能比归属节点上的旧，最多旧 ttl；本节点的 Set、Delete 会立即删除 L1 中的记录。
+
+// EnableL1 caches values fetched from peers in a local LRU of at most bytes for ttl.
+// bytes <= 0 or ttl <= 0 disables L1.
+func (g *Group) EnableL1(bytes int64, ttl time.Duration) {
+	if bytes <= 0 || ttl <= 0 {
+		g.l1, g.l1TTL = nil, 0
+		return
+	}
+	g.l1, g.l1TTL = &cache{cacheBytes: bytes}, ttl
+}
+
+// lookupL1 查找从远程节点获取并缓存在 L1 中的 key
+func (g *Group) lookupL1(key string) (ByteView, bool) {
+	if g.l1 == nil {
+		return ByteView{}, false
+	}
+	return g.l1.get(key)
+}
+
+// populateL1 缓存从远程节点获取到的值
+func (g *Group) populateL1(key string, value ByteView) {
+	if g.l1 != nil {
+		g.l1.addWithTTL(key, value, g.l1TTL)
+	}
+}
+
+// removeL1 删除 L1 中的 key
+func (g *Group) removeL1(key string) {
+	if g.l1 != nil {
+		g.l1.remove(key)
+	}
+}
@@ -0,0 +1,227 @@
+package lfu
+
+import (
+	"DCache/dcache/lru"
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// LFU(Least Frequently Used) 淘汰访问次数最少的记录，访问次数相同时淘汰最久未被访问的记录。
+// 适合少数 key 长期处于热点的场景：热点 key 的访问次数高，不会因为大量一次性访问而被淘汰。
+
+// Value 与 lru.Value 是同一个类型，使得 lfu.Cache 和 lru.Cache 可以互相替换
+type Value = lru.Value
+
+// EvictReason 与 lru.EvictReason 是同一个类型
+type EvictReason = lru.EvictReason
+
+type Cache struct {
+	maxBytes int64             // maxBytes is the max memory bytes the cache can use
+	nbyte    int64             // nbytes is the memory bytes the cache is using now
+	ttl      time.Duration     // ttl is the default time-to-live of entries, 0 means never expire
+	tick     int64             // tick 为逻辑时钟，每次访问自增，用于访问次数相同时比较新旧
+	queue    entryHeap         // 以访问次数为优先级的小顶堆，堆顶为最应被淘汰的记录
+	cache    map[string]*entry // 映射 key 与堆中的记录
+	// 当某条记录被移除时的回调函数，reason 为记录被移除的原因
+	OnEvicted func(key string, value Value, reason EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time
+	count  int64 // 访问次数
+	tick   int64 // 最近一次访问时的逻辑时钟
+	index  int   // 在堆中的下标，由 heap.Interface 维护
+}
+
+// New is the Constructor of Cache
+// ttl 为记录的默认过期时间，通过 Add 添加的记录都会使用该过期时间，0 表示永不过期
+func New(maxBytes int64, ttl time.Duration, onEvicted func(key string, value Value, reason EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ttl:       ttl,
+		cache:     map[string]*entry{},
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get look ups a key's value and increases its access count
+// 若记录已过期，则视为未命中，并将其删除（惰性过期）
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	e, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expiredNow() {
+		c.removeEntry(e, lru.EvictExpired)
+		return nil, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+// Peek returns the value of key without increasing its access count
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok && !e.expiredNow() {
+		return e.value, true
+	}
+	return
+}
+
+// Add adds a value to the cache
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl
+// ttl <= 0 表示该记录永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	if e, ok := c.cache[key]; ok {
+		c.nbyte = c.nbyte - int64(e.value.Len()) + int64(value.Len())
+		e.value = value
+		e.expire = expire
+		c.touch(e)
+	} else {
+		// 新记录的访问次数最少，先腾出空间再插入，避免新记录刚插入就被淘汰
+		size := int64(len(key)) + int64(value.Len())
+		for c.maxBytes != 0 && c.nbyte+size > c.maxBytes && c.queue.Len() > 0 {
+			c.RemoveOldest()
+		}
+		c.tick++
+		e := &entry{
+			key:    key,
+			value:  value,
+			expire: expire,
+			count:  1,
+			tick:   c.tick,
+		}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nbyte += size
+	}
+	for c.maxBytes != 0 && c.nbyte > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// Remove removes the provided key from the cache
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e, lru.EvictRemoved)
+	}
+}
+
+// RemoveOldest removes the least frequently used item
+// 为了与 lru.Cache 保持相同的方法集，沿用 RemoveOldest 这个名字
+func (c *Cache) RemoveOldest() {
+	if c.queue.Len() > 0 {
+		c.removeEntry(c.queue[0], lru.EvictCapacity)
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear removes all items from the cache
+// 重置小顶堆和 map，并对每条被移除的记录调用 OnEvicted
+func (c *Cache) Clear() {
+	queue := c.queue
+	c.queue = nil
+	c.cache = map[string]*entry{}
+	c.nbyte = 0
+	if c.OnEvicted != nil {
+		for _, e := range queue {
+			c.OnEvicted(e.key, e.value, lru.EvictCleared)
+		}
+	}
+}
+
+// Bytes returns the memory bytes the cache is using now
+// 每条记录占用的字节数为 key 的长度与 value.Len() 之和
+func (c *Cache) Bytes() int64 {
+	return c.nbyte
+}
+
+// MaxBytes returns the max memory bytes the cache can use, 0 means unbounded
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Keys returns a copy of the keys in the cache, in eviction order
+// 按照淘汰顺序返回所有 key，即最应被淘汰的记录排在最前面，与 lru.Cache.Keys 的语义保持一致
+func (c *Cache) Keys() []string {
+	entries := make(entryHeap, len(c.queue))
+	copy(entries, c.queue)
+	sort.Slice(entries, entries.Less)
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (c *Cache) touch(e *entry) {
+	c.tick++
+	e.count++
+	e.tick = c.tick
+	heap.Fix(&c.queue, e.index)
+}
+
+func (c *Cache) removeEntry(e *entry, reason EvictReason) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nbyte = c.nbyte - int64(len(e.key)) - int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// expiredNow 与 expired 相同，但永不过期的记录不需要读取当前时间
+func (e *entry) expiredNow() bool {
+	return !e.expire.IsZero() && time.Now().After(e.expire)
+}
+
+// entryHeap 实现了 heap.Interface，访问次数少的记录优先级更高，访问次数相同时更久未访问的记录优先级更高
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].count < h[j].count
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,91 @@
+package lfu
+
+import (
+	"DCache/dcache/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string // 定义String实现了Value接口
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), 0, nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	evicted := make([]string, 0)
+	lfu := New(int64(6), 0, func(key string, value Value, reason EvictReason) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("k1", String("1"))
+	lfu.Add("k2", String("2"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k2")
+	// k3 触发淘汰，k2 的访问次数少于 k1，应被淘汰
+	lfu.Add("k3", String("3"))
+	lfu.Add("k4", String("4"))
+
+	if _, ok := lfu.Get("k1"); !ok || lfu.Len() != 2 {
+		t.Fatalf("frequently used k1 should survive eviction")
+	}
+	expect := []string{"k2", "k3"}
+	if !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, evicted)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lfu := New(int64(0), 0, nil)
+	lfu.Add("k1", String("1"))
+	lfu.Add("k2", String("2"))
+	lfu.Add("k3", String("3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+
+	// 按淘汰顺序返回：k2 访问次数最少，k1 访问次数最多
+	expect := []string{"k2", "k3", "k1"}
+	if keys := lfu.Keys(); !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Keys() = %v, expect %v", keys, expect)
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	c := New(int64(12), 0, func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.AddWithTTL("k3", String("3"), time.Millisecond)
+	c.Add("k4", String("4"))
+	c.Add("k5", String("5")) // 超出 12 字节，淘汰 k1
+	c.Remove("k2")
+	time.Sleep(5 * time.Millisecond)
+	c.Get("k3")
+	c.Clear()
+
+	expect := map[string]EvictReason{
+		"k1": lru.EvictCapacity,
+		"k2": lru.EvictRemoved,
+		"k3": lru.EvictExpired,
+		"k4": lru.EvictCleared,
+		"k5": lru.EvictCleared,
+	}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, but got %v", expect, reasons)
+	}
+}
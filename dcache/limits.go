@@ -0,0 +1,38 @@
+package dcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrResponseTooLarge is returned when the body of a peer's response exceeds HTTPPoolOptions.MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+const (
+	// defaultMaxBodyBytes 为请求与响应 body 默认的字节数上限
+	defaultMaxBodyBytes = 64 << 20
+	// maxDrainBytes 为关闭响应前最多丢弃的剩余字节数，剩余数据更多时不再复用连接
+	maxDrainBytes = 64 << 10
+)
+
+// readResponse 读取响应 body，超过 h.maxResponseBytes 时返回 ErrResponseTooLarge，不会把整个 body 读入内存
+func (h *httpGetter) readResponse(res *http.Response) ([]byte, error) {
+	if h.maxResponseBytes <= 0 {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response body: %v", err)
+		}
+		return body, nil
+	}
+	// 多读取一个字节，用于区分 body 恰好等于上限与超过上限
+	body, err := io.ReadAll(io.LimitReader(res.Body, h.maxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	if int64(len(body)) > h.maxResponseBytes {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, h.maxResponseBytes)
+	}
+	return body, nil
+}
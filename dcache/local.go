@@ -0,0 +1,156 @@
+package dcache
+
+import (
+	"DCache/dcache/consistenthash"
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 进程内的节点间通信，不经过网络，适用于在同一个进程中模拟多个节点的集成测试，或者将多个节点嵌入同一个程序。
+//
+// 同一个进程中 group 的名称是唯一的，因此每个"节点"需要使用不同名称的 Group，
+// 再通过 LocalGetter.AddGroup 将请求中的 group 名称映射到该节点自己的 Group 上。
+
+// LocalGetter implements PeerGetter by calling the groups of a node in this process directly.
+type LocalGetter struct {
+	mu     sync.Mutex
+	groups map[string]*Group // 映射请求中的 group 名称与该节点的 Group
+}
+
+var _ PeerGetter = (*LocalGetter)(nil)
+
+func NewLocalGetter() *LocalGetter {
+	return &LocalGetter{groups: make(map[string]*Group)}
+}
+
+// AddGroup serves requests for the group named name with g.
+// 请求只作用于 g 的本地缓存，不会再转发给其他节点，与 Serve* 的语义相同
+func (l *LocalGetter) AddGroup(name string, g *Group) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.groups[name] = g
+}
+
+func (l *LocalGetter) lookupGroup(name string) (*Group, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if group, ok := l.groups[name]; ok {
+		return group, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSuchGroup, name)
+}
+
+func (l *LocalGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveGet(ctx, in, out)
+}
+
+func (l *LocalGetter) Delete(ctx context.Context, in *pb.Request) error {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	group.removeLocally(in.Key)
+	return nil
+}
+
+func (l *LocalGetter) Set(ctx context.Context, in *pb.Request) error {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveSet(in)
+}
+
+func (l *LocalGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveGetMulti(ctx, in, out)
+}
+
+func (l *LocalGetter) Clear(ctx context.Context, in *pb.Request) error {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	group.Clear()
+	return nil
+}
+
+func (l *LocalGetter) Has(ctx context.Context, in *pb.Request) (bool, error) {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return false, err
+	}
+	return group.hasLocally(in.Key), nil
+}
+
+func (l *LocalGetter) DeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	group, err := l.lookupGroup(in.Group)
+	if err != nil {
+		return 0, err
+	}
+	return group.deletePrefixLocally(in.Key), nil
+}
+
+// LocalPool implements PeerPicker and PeerLister for a pool of in-process peers.
+type LocalPool struct {
+	self    string // 本节点的地址，仅用于在哈希环中标识本节点
+	mu      sync.Mutex
+	peers   *consistenthash.Map     // 用于根据具体的key选择节点
+	getters map[string]*LocalGetter // 映射节点地址与对应的LocalGetter
+}
+
+var (
+	_ PeerPicker = (*LocalPool)(nil)
+	_ PeerLister = (*LocalPool)(nil)
+)
+
+func NewLocalPool(self string) *LocalPool {
+	return &LocalPool{
+		self:    self,
+		peers:   consistenthash.New(defaultReplicas, nil),
+		getters: make(map[string]*LocalGetter),
+	}
+}
+
+// Add adds the peer at addr to the pool, requests to it are served by getter.
+// 本节点也需要加入哈希环，此时 getter 可以为 nil
+func (p *LocalPool) Add(addr string, getter *LocalGetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.getters[addr]; !ok {
+		p.peers.Add(addr)
+	}
+	p.getters[addr] = getter
+}
+
+// Peers returns the clients of all remote peers, implements PeerLister.
+func (p *LocalPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.getters))
+	for addr, getter := range p.getters {
+		if addr != p.self && getter != nil {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+// PickPeer picks a peer according to key
+func (p *LocalPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if peer := p.peers.Get(key); peer != "" && peer != p.self && p.getters[peer] != nil {
+		return p.getters[peer], true
+	}
+	return nil, false
+}
@@ -0,0 +1,50 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestLocalPool(t *testing.T) {
+	// 在同一个进程中模拟节点 a 和 b，两个节点使用不同名称的 Group
+	a := NewGroup("local-a", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("a:" + key), nil
+	}))
+	b := NewGroup("local-b", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("b:" + key), nil
+	}))
+	getterB := NewLocalGetter()
+	getterB.AddGroup("local-a", b) // 节点 a 发来的 local-a 请求由节点 b 的 Group 处理
+
+	pool := NewLocalPool("a")
+	pool.Add("a", nil)
+	pool.Add("b", getterB)
+	a.RegisterPeers(pool)
+
+	// 找到一个归属于节点 b 的 key
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if _, ok := pool.PickPeer(key); ok {
+			break
+		}
+	}
+	if view, err := a.Get(key); err != nil || view.String() != "b:"+key {
+		t.Fatalf("expect %s to be served by peer b, but got %q, %v", key, view.String(), err)
+	}
+	if keys := b.Keys(); len(keys) != 1 || keys[0] != key {
+		t.Fatalf("peer b should cache %s, but got %v", key, keys)
+	}
+	if stats := a.Stats(); stats.PeerHits != 1 || stats.Loads != 0 {
+		t.Fatalf("expect 1 peer hit and no local load, but got %+v", stats)
+	}
+
+	if err := a.ClearAll(context.Background()); err != nil || len(b.Keys()) != 0 {
+		t.Fatalf("ClearAll should clear peer b: %v", err)
+	}
+	if err := getterB.Delete(context.Background(), &pb.Request{Group: "unknown", Key: key}); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
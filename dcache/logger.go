@@ -0,0 +1,29 @@
+package dcache
+
+// Logger is the interface DCache prints logs with, *log.Logger implements it.
+// 默认不输出任何日志，避免污染使用方的输出。可以通过 Group.SetLogger、HTTPPool.SetLogger 设置，
+// 例如传入 log.Default() 输出到标准库的 log，或者包装一个结构化日志库。
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// noopLogger 丢弃所有日志，是默认的 Logger
+type noopLogger struct{}
+
+func (noopLogger) Printf(format string, v ...interface{}) {}
+
+// SetLogger sets the logger of the group, nil disables logging.
+func (g *Group) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = noopLogger{}
+	}
+	g.logger = logger
+}
+
+// SetLogger sets the logger of the pool, nil disables logging.
+func (p *HTTPPool) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = noopLogger{}
+	}
+	p.logger = logger
+}
@@ -1,84 +1,320 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type Cache struct {
-	maxBytes int64                    // maxBytes is the max memory bytes the cache can use
-	nbyte    int64                    // nbytes is the memory bytes the cache is using now
-	ll       *list.List               // list.List是标准库中双向链表
-	cache    map[string]*list.Element // list.Element 为双向链表中每个节点的类型，其中定义了前后向的指针，以及类型为空接口的Value
-	// 当某条记录被移除时的回调函数
-	OnEvicted func(key string, value Value)
+	maxBytes   int64                    // maxBytes is the max memory bytes the cache can use
+	lowBytes   int64                    // lowBytes is the memory bytes to evict down to once maxBytes is exceeded
+	maxEntries int                      // maxEntries is the max number of entries the cache can hold
+	capacity   int                      // capacity is the size hint of the map, used again by Clear
+	nbyte      int64                    // nbytes is the memory bytes the cache is using now
+	ttl        time.Duration            // ttl is the default time-to-live of entries, 0 means never expire
+	ll         *list.List               // list.List是标准库中双向链表
+	cache      map[string]*list.Element // list.Element 为双向链表中每个节点的类型，其中定义了前后向的指针，以及类型为空接口的Value
+	// 当某条记录被移除时的回调函数，reason 为记录被移除的原因
+	OnEvicted func(key string, value Value, reason EvictReason)
 }
 
 // 键值对 entry 是双向链表节点的数据类型，在链表中仍保存每个值对应的 key 的好处在于，淘汰队首节点时，需要用 key 从字典中删除对应的映射
 // value 的类型是接口类型 Value，这样的设计允许值是任何实现了 Value 接口的类型，更具通用性
+// expire 为该记录的过期时间，零值表示永不过期
+// count 与 lastAccess 为该记录被 Get 命中的次数与最近一次访问的时间，用于分析访问模式
 type entry struct {
-	key   string
-	value Value
+	key        string
+	value      Value
+	expire     time.Time
+	count      int
+	lastAccess time.Time
 }
 
 type Value interface {
 	Len() int
 }
 
+// EvictReason describes why an entry was removed from the cache.
+// 例如 write-behind 的持久化回调可以在淘汰时落盘，而在显式删除时跳过
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // 超出内存字节数或记录条数的限制，或者被 RemoveOldest 淘汰
+	EvictRemoved                     // 被 Remove 显式删除
+	EvictExpired                     // 过期后被删除
+	EvictCleared                     // 被 Clear 清空
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictRemoved:
+		return "removed"
+	case EvictExpired:
+		return "expired"
+	case EvictCleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// Entry is a key-value pair evicted from the cache, see AddDeferred.
+type Entry struct {
+	Key    string
+	Value  Value
+	Reason EvictReason
+}
+
+// Options configures a Cache, the zero value of each field means unbounded or disabled.
+type Options struct {
+	MaxBytes   int64         // 缓存最多使用的内存字节数，0 表示不限制
+	MaxEntries int           // 缓存最多容纳的记录条数，0 表示不限制
+	TTL        time.Duration // 记录的默认过期时间，0 表示永不过期
+	// LowWatermark 为 MaxBytes 的比例，占用的内存超过 MaxBytes 时一次淘汰到 MaxBytes*LowWatermark 以下，
+	// 避免在边界附近每次 Add 都淘汰一条记录。取值范围为 (0, 1)，0 表示只淘汰到不超过 MaxBytes 为止
+	LowWatermark float64
+	// InitialCapacity 为预计容纳的记录条数，用于预先分配 map 的容量，避免记录增长过程中反复扩容带来的延迟抖动。
+	// 只是一个提示，不限制记录条数，0 表示不预先分配
+	InitialCapacity int
+	OnEvicted       func(key string, value Value, reason EvictReason)
+}
+
 // New is the Constructor of Cache
-func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
-	return &Cache{
-		maxBytes:  maxBytes,
-		ll:        list.New(),
-		cache:     map[string]*list.Element{},
+// ttl 为记录的默认过期时间，通过 Add 添加的记录都会使用该过期时间，0 表示永不过期
+func New(maxBytes int64, ttl time.Duration, onEvicted func(key string, value Value, reason EvictReason)) *Cache {
+	return NewWithOptions(Options{
+		MaxBytes:  maxBytes,
+		TTL:       ttl,
 		OnEvicted: onEvicted,
+	})
+}
+
+// NewWithOptions creates a Cache configured by opts
+// 当内存字节数超过 MaxBytes 或记录条数超过 MaxEntries 时，都会淘汰最久未被访问的记录
+func NewWithOptions(opts Options) *Cache {
+	if opts.LowWatermark < 0 || opts.LowWatermark >= 1 {
+		panic("low watermark must be in [0, 1)")
+	}
+	if opts.InitialCapacity < 0 {
+		panic("initial capacity must not be negative")
+	}
+	lowBytes := opts.MaxBytes
+	if opts.LowWatermark > 0 {
+		lowBytes = int64(float64(opts.MaxBytes) * opts.LowWatermark)
+	}
+	return &Cache{
+		maxBytes:   opts.MaxBytes,
+		lowBytes:   lowBytes,
+		maxEntries: opts.MaxEntries,
+		capacity:   opts.InitialCapacity,
+		ttl:        opts.TTL,
+		ll:         list.New(),
+		cache:      make(map[string]*list.Element, opts.InitialCapacity),
+		OnEvicted:  opts.OnEvicted,
 	}
 }
 
 // Get look ups a key's value
 // 查找的步骤：1.从字典中找到对应的双向链表的节点 2.将该节点移动到队尾
+// 若记录已过期，则视为未命中，并将其删除（惰性过期）
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		now := time.Now()
+		if kv.expired(now) {
+			c.removeElement(ele, EvictExpired)
+			return nil, false
+		}
+		kv.count++
+		kv.lastAccess = now
 		c.ll.MoveToFront(ele) // 将链表中的节点 ele 移动到队尾（双向链表作为队列，队首队尾是相对的，在这里约定 front 为队尾）
-		return ele.Value.(*entry).value, ok
+		return kv.value, ok
+	}
+	return
+}
+
+// Peek returns the value of key without updating its recency
+// 与 Get 不同，Peek 不会将节点移动到队尾，也不会删除过期的记录，适合只读的管理工具使用
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if !kv.expiredNow() {
+			return kv.value, true
+		}
 	}
 	return
 }
 
+// EntryStats returns how many times key was hit by Get, and the time of its last access.
+// 从未被 Get 命中的记录，lastAccess 为写入的时间；覆盖写入同一个 key 不会重置统计。与 Peek 一样不影响记录的新旧
+func (c *Cache) EntryStats(key string) (count int, lastAccess time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if !kv.expiredNow() {
+			return kv.count, kv.lastAccess, true
+		}
+	}
+	return
+}
+
+// Contains checks if a key is in the cache without updating its recency
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
 // RemoveOldest removes the oldest item
 // 删除双向链表队首的元素，然后将其在map中对应的映射也删除
 func (c *Cache) RemoveOldest() {
-	ele := c.ll.Back()
-	if ele != nil {
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbyte = c.nbyte - int64(len(kv.key)) - int64(kv.value.Len())
-		c.ll.Remove(ele)
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+	if kv := c.removeOldest(); kv != nil && c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, EvictCapacity)
+	}
+}
+
+// Remove removes the provided key from the cache
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	kv := c.unlink(ele)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
+// removeOldest 删除队首的记录但不调用 OnEvicted，缓存为空时返回 nil
+func (c *Cache) removeOldest() *entry {
+	if ele := c.ll.Back(); ele != nil {
+		return c.unlink(ele)
+	}
+	return nil
+}
+
+// unlink 将节点从链表和 map 中删除，并更新占用的字节数
+func (c *Cache) unlink(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbyte = c.nbyte - int64(len(kv.key)) - int64(kv.value.Len())
+	c.ll.Remove(ele)
+	return kv
+}
+
 // Add adds a value to the cache
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl
+// ttl <= 0 表示该记录永不过期
+// 写入较大的值可能一次淘汰多条记录，所有记录都淘汰完毕、缓存状态一致后，才依次调用 OnEvicted
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	c.NotifyEvicted(c.AddDeferred(key, value, ttl))
+}
+
+// AddDeferred is like AddWithTTL, but returns the evicted entries instead of calling OnEvicted.
+// OnEvicted 较慢（如写磁盘）时，调用方可以先释放保护 Cache 的锁，再调用 NotifyEvicted，
+// 避免回调期间阻塞其他 Get/Add
+func (c *Cache) AddDeferred(key string, value Value, ttl time.Duration) (evicted []Entry) {
+	now := time.Now()
+	var expire time.Time
+	if ttl > 0 {
+		expire = now.Add(ttl)
+	}
 	ele, exist := c.cache[key]
 	if exist {
-		c.nbyte = c.nbyte - int64(ele.Value.(*entry).value.Len()) + int64(value.Len())
-		ele.Value.(*entry).value = value
+		kv := ele.Value.(*entry)
+		c.nbyte = c.nbyte - int64(kv.value.Len()) + int64(value.Len())
+		kv.value = value
+		kv.expire = expire
 		c.ll.MoveToFront(ele)
 	} else {
 		entry := &entry{
-			key:   key,
-			value: value,
+			key:        key,
+			value:      value,
+			expire:     expire,
+			lastAccess: now,
 		}
 		ele := c.ll.PushFront(entry)
 		c.cache[key] = ele
 		c.nbyte += int64(len(key)) + int64(value.Len())
 	}
-	for c.maxBytes != 0 && c.nbyte > c.maxBytes {
-		c.RemoveOldest()
+	if !c.overflow() {
+		return nil
+	}
+	// 超过内存上限时一次淘汰到低水位以下，淘汰到低水位时不会淘汰刚写入的记录
+	for c.overflow() || (c.maxBytes != 0 && c.nbyte > c.lowBytes && c.ll.Len() > 1) {
+		kv := c.removeOldest()
+		evicted = append(evicted, Entry{Key: kv.key, Value: kv.value, Reason: EvictCapacity})
+	}
+	return evicted
+}
+
+// NotifyEvicted calls OnEvicted for each entry returned by AddDeferred.
+func (c *Cache) NotifyEvicted(evicted []Entry) {
+	if c.OnEvicted == nil {
+		return
+	}
+	for _, e := range evicted {
+		c.OnEvicted(e.Key, e.Value, e.Reason)
 	}
 }
 
+// overflow 判断缓存是否超出了内存字节数或记录条数的限制
+func (c *Cache) overflow() bool {
+	return (c.maxBytes != 0 && c.nbyte > c.maxBytes) ||
+		(c.maxEntries != 0 && c.ll.Len() > c.maxEntries)
+}
+
 // Len the number of cache entries
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Clear removes all items from the cache
+// 重置双向链表和 map，并对每条被移除的记录调用 OnEvicted
+func (c *Cache) Clear() {
+	ll := c.ll
+	c.ll = list.New()
+	c.cache = make(map[string]*list.Element, c.capacity)
+	c.nbyte = 0
+	if c.OnEvicted != nil {
+		for ele := ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			c.OnEvicted(kv.key, kv.value, EvictCleared)
+		}
+	}
+}
+
+// Bytes returns the memory bytes the cache is using now
+// 每条记录占用的字节数为 key 的长度与 value.Len() 之和
+func (c *Cache) Bytes() int64 {
+	return c.nbyte
+}
+
+// MaxBytes returns the max memory bytes the cache can use, 0 means unbounded
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Keys returns a copy of the keys in the cache, from oldest to newest
+// 从队首（最久未被访问）向队尾遍历双向链表，返回的切片为副本，修改它不会影响缓存
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// expiredNow 与 expired 相同，但永不过期的记录不需要读取当前时间
+func (e *entry) expiredNow() bool {
+	return !e.expire.IsZero() && time.Now().After(e.expire)
+}
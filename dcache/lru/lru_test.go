@@ -1,8 +1,12 @@
 package lru
 
 import (
+	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 type String string // 定义String实现了Value接口
@@ -12,7 +16,7 @@ func (s String) Len() int {
 }
 
 func TestGet(t *testing.T) {
-	lru := New(int64(0), nil)
+	lru := New(int64(0), 0, nil)
 	lru.Add("key1", String("1234"))
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
@@ -26,7 +30,7 @@ func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
 	maxBytes := len(k1 + k2 + v1 + v2)
-	lru := New(int64(maxBytes), nil)
+	lru := New(int64(maxBytes), 0, nil)
 	lru.Add(k1, String(v1))
 	lru.Add(k2, String(v2))
 	lru.Add(k3, String(v3))
@@ -36,12 +40,90 @@ func TestRemoveoldest(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	lru := New(int64(0), 0, nil)
+	lru.AddWithTTL("expired", String("1"), time.Nanosecond)
+	lru.Add("key1", String("1234"))
+	time.Sleep(time.Millisecond)
+	if v, ok := lru.Peek("key1"); !ok || string(v.(String)) != "1234" || !lru.Contains("key1") {
+		t.Fatalf("peek key1=1234 failed")
+	}
+	if _, ok := lru.Peek("key2"); ok || lru.Contains("key2") {
+		t.Fatalf("peek missing key2 failed")
+	}
+	if lru.Contains("expired") {
+		t.Fatalf("expired key should not be contained")
+	}
+}
+
+func TestPeekDoesNotPromote(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	lru := New(int64(len(k1+k2+v1+v2)), 0, nil)
+	lru.Add(k1, String(v1))
+	lru.Add(k2, String(v2))
+	// Peek 不会更新 key1 的访问顺序，key1 仍然是最久未被访问的记录
+	lru.Peek(k1)
+	lru.Add(k3, String(v3))
+
+	if lru.Contains(k1) || !lru.Contains(k2) {
+		t.Fatalf("peeked key1 should still be evicted as the oldest")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lru := New(int64(0), 0, nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.Add("key3", String("3"))
+	lru.Get("key1")
+
+	keys := lru.Keys()
+	if expect := []string{"key2", "key3", "key1"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("Keys() = %v, expect %v", keys, expect)
+	}
+	keys[0] = "mutated"
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("mutating the returned keys should not affect the cache")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	lru := New(int64(100), 0, nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("k2", String("12"))
+	if lru.Bytes() != 12 || lru.MaxBytes() != 100 {
+		t.Fatalf("expect 12/100 bytes, but got %d/%d", lru.Bytes(), lru.MaxBytes())
+	}
+	lru.Add("key1", String("1"))
+	lru.Remove("k2")
+	if lru.Bytes() != 5 {
+		t.Fatalf("expect 5 bytes after update and remove, but got %d", lru.Bytes())
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	lru := NewWithOptions(Options{MaxEntries: 100})
+	for i := 0; i < 1000; i++ {
+		lru.Add(strconv.Itoa(i), String("1"))
+	}
+	if lru.Len() != 100 {
+		t.Fatalf("expect Len() capped at 100, but got %d", lru.Len())
+	}
+	if _, ok := lru.Get("999"); !ok {
+		t.Fatalf("the newest entry should be kept")
+	}
+	if _, ok := lru.Get("0"); ok {
+		t.Fatalf("the oldest entry should be evicted")
+	}
+}
+
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		keys = append(keys, key)
 	}
-	lru := New(int64(10), callback)
+	lru := New(int64(10), 0, callback)
 	lru.Add("key1", String("123456"))
 	lru.Add("k2", String("k2"))
 	lru.Add("k3", String("k3"))
@@ -53,3 +135,224 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestBatchEviction(t *testing.T) {
+	var lru *Cache
+	keys := make([]string, 0)
+	lru = New(int64(10), 0, func(key string, value Value, reason EvictReason) {
+		// 回调时所有需要淘汰的记录都已被删除，缓存状态是一致的
+		if lru.Bytes() > 10 || lru.Len() != 1 {
+			t.Errorf("OnEvicted(%s) is called before bookkeeping is done: %d bytes, %d entries", key, lru.Bytes(), lru.Len())
+		}
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("12"))
+	lru.Add("k2", String("34"))
+	lru.Add("big", String("1234567"))
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+}
+
+func TestAddDeferred(t *testing.T) {
+	var mu sync.Mutex
+	lru := New(int64(10), 0, func(key string, value Value, reason EvictReason) {
+		time.Sleep(50 * time.Millisecond) // 模拟写磁盘等较慢的回调
+	})
+	lru.Add("k1", String("12"))
+	lru.Add("k2", String("34"))
+
+	added, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		mu.Lock()
+		evicted := lru.AddDeferred("big", String("1234567"), 0)
+		mu.Unlock()
+		close(added)
+		if len(evicted) != 2 {
+			t.Errorf("expect 2 evicted entries, but got %d", len(evicted))
+		}
+		lru.NotifyEvicted(evicted) // 释放锁之后再调用回调
+	}()
+
+	<-added
+	start := time.Now()
+	mu.Lock()
+	_, ok := lru.Get("big")
+	mu.Unlock()
+	if elapsed := time.Since(start); !ok || elapsed > 50*time.Millisecond {
+		t.Fatalf("Get should not wait for OnEvicted, but took %v, hit %v", elapsed, ok)
+	}
+	<-done
+}
+
+func TestClear(t *testing.T) {
+	evicted := make([]string, 0)
+	lru := New(int64(0), 0, func(key string, value Value, reason EvictReason) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.Add("key3", String("3"))
+	lru.Clear()
+
+	if lru.Len() != 0 || lru.nbyte != 0 {
+		t.Fatalf("cache should be empty after Clear, but got %d entries", lru.Len())
+	}
+	if expect := []string{"key1", "key2", "key3"}; !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, evicted)
+	}
+	lru.Add("key1", String("1"))
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache should be usable after Clear")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	evicted := make([]string, 0)
+	lru := New(int64(0), 0, func(key string, value Value, reason EvictReason) {
+		evicted = append(evicted, key)
+	})
+	lru.AddWithTTL("key1", String("1234"), 10*time.Millisecond)
+	lru.Add("key2", String("5678"))
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 before expiration failed")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("key1 should expire after 10ms")
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("key2 without ttl should never expire")
+	}
+	if !reflect.DeepEqual(evicted, []string{"key1"}) {
+		t.Fatalf("Call OnEvicted on expiration failed, got %s", evicted)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	lru := New(int64(0), 10*time.Millisecond, nil)
+	lru.Add("key1", String("1234"))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("key1 should expire with default ttl")
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	c := New(int64(12), 0, func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.AddWithTTL("k3", String("3"), time.Millisecond)
+	c.Add("k4", String("4"))
+	c.Add("k5", String("5")) // 超出 12 字节，淘汰 k1
+	c.Remove("k2")
+	time.Sleep(5 * time.Millisecond)
+	c.Get("k3")
+	c.Clear()
+
+	expect := map[string]EvictReason{
+		"k1": EvictCapacity,
+		"k2": EvictRemoved,
+		"k3": EvictExpired,
+		"k4": EvictCleared,
+		"k5": EvictCleared,
+	}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, but got %v", expect, reasons)
+	}
+}
+
+func TestEntryStats(t *testing.T) {
+	lru := New(int64(0), 0, nil)
+	before := time.Now()
+	lru.Add("key1", String("1234"))
+	if count, last, ok := lru.EntryStats("key1"); !ok || count != 0 || last.Before(before) {
+		t.Fatalf("expect a new entry to have no hits, but got %d, %v, %v", count, last, ok)
+	}
+	for i := 0; i < 3; i++ {
+		lru.Get("key1")
+	}
+	lru.Peek("key1") // Peek 不计入访问次数
+	count, last, ok := lru.EntryStats("key1")
+	if !ok || count != 3 {
+		t.Fatalf("expect 3 hits, but got %d, %v", count, ok)
+	}
+	lru.Add("key1", String("5678"))
+	time.Sleep(time.Millisecond)
+	lru.Get("key1")
+	if count, last2, _ := lru.EntryStats("key1"); count != 4 || !last2.After(last) {
+		t.Fatalf("expect the stats to survive an update, but got %d, %v", count, last2)
+	}
+	if _, _, ok := lru.EntryStats("key2"); ok {
+		t.Fatalf("expect no stats for a missing key")
+	}
+}
+
+func TestLowWatermark(t *testing.T) {
+	// 每条记录占用 10 字节，超过 100 字节时淘汰到 70 字节以下
+	var evicted []string
+	lru := NewWithOptions(Options{MaxBytes: 100, LowWatermark: 0.7, OnEvicted: func(key string, value Value, reason EvictReason) {
+		evicted = append(evicted, key)
+	}})
+	for i := 0; i < 10; i++ {
+		lru.Add(fmt.Sprintf("k%d", i), String("12345678"))
+	}
+	if len(evicted) != 0 || lru.Bytes() != 100 {
+		t.Fatalf("expect no eviction until maxBytes is exceeded, but evicted %v", evicted)
+	}
+	lru.Add("k10", String("12345678"))
+	if len(evicted) != 5 || lru.Bytes() != 61 {
+		t.Fatalf("expect to evict down to the low watermark in one pass, but evicted %v with %d bytes left", evicted, lru.Bytes())
+	}
+	if _, ok := lru.Get("k10"); !ok {
+		t.Fatalf("the newest entry should be kept")
+	}
+}
+
+// BenchmarkEviction 比较稳定写入压力下，每次写入触发淘汰的次数（evict-passes/op）
+func BenchmarkEviction(b *testing.B) {
+	for _, watermark := range []float64{0, 0.9} {
+		b.Run(fmt.Sprintf("watermark=%v", watermark), func(b *testing.B) {
+			lru := NewWithOptions(Options{MaxBytes: 64 << 10, LowWatermark: watermark})
+			keys := make([]string, 1<<16)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+			}
+			var passes, evictions int
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if evicted := lru.AddDeferred(keys[i%len(keys)], String("0123456789"), 0); len(evicted) > 0 {
+					passes++
+					evictions += len(evicted)
+				}
+			}
+			b.ReportMetric(float64(passes)/float64(b.N), "evict-passes/op")
+			b.ReportMetric(float64(evictions)/float64(b.N), "evictions/op")
+		})
+	}
+}
+
+// BenchmarkAddCapacity 比较从空缓存写入固定条数的记录时，预先分配 map 容量与不预先分配的差别
+func BenchmarkAddCapacity(b *testing.B) {
+	const entries = 100000
+	keys := make([]string, entries)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, capacity := range []int{0, entries} {
+		b.Run(fmt.Sprintf("capacity=%d", capacity), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				lru := NewWithOptions(Options{InitialCapacity: capacity})
+				for _, key := range keys {
+					lru.Add(key, String("0123456789"))
+				}
+			}
+		})
+	}
+}
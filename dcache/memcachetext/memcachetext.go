@@ -0,0 +1,243 @@
+package memcachetext
+
+import (
+	"DCache/dcache"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 兼容 memcached 文本协议的前端，使现有的 memcached 客户端与运维工具可以直接读写 DCache。
+// 只支持 get 与 set 两个命令，分别转换为 Group.Get 与 Group.Set：
+//
+//	get <key>*\r\n
+//	set <key> <flags> <exptime> <bytes> [noreply]\r\n<data block>\r\n
+//
+// DCache 不保存 flags，get 返回的 flags 始终为 0；exptime 同样被忽略，过期策略由 Group 的配置决定。
+
+const (
+	maxKeyLength = 250     // memcached 的 key 最长 250 字节
+	maxItemSize  = 1 << 20 // set 的值最大 1MB，与 memcached 的默认配置相同
+	// maxLineLength 为命令行的最大长度，与 memcached 相同，避免客户端不发送换行符时无限制地缓存数据
+	maxLineLength = 2048
+)
+
+// Server serves the memcached text protocol for a Group.
+type Server struct {
+	group    *dcache.Group
+	logger   dcache.Logger
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// NewServer creates a Server which reads and writes group.
+func NewServer(group *dcache.Group) *Server {
+	return &Server{
+		group:  group,
+		logger: log.New(io.Discard, "", 0),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// SetLogger sets the logger of the server, nil disables logging.
+func (s *Server) SetLogger(logger dcache.Logger) {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	s.logger = logger
+}
+
+// ListenAndServe listens on addr and serves connections until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves connections on l until Close is called, it returns nil after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// track 记录新的连接，Server 已关闭时返回 false
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReaderSize(conn, maxLineLength)
+	w := bufio.NewWriter(conn)
+	for {
+		// 缓冲区的大小即为命令行的最大长度，超出时 ReadSlice 返回 bufio.ErrBufferFull
+		slice, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		line := string(slice)
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Printf("[memcachetext] read from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else {
+			switch fields[0] {
+			case "get":
+				s.get(w, fields[1:])
+			case "set":
+				if err := s.set(r, w, fields[1:]); err != nil {
+					s.logger.Printf("[memcachetext] read from %s: %v", conn.RemoteAddr(), err)
+					return
+				}
+			case "quit":
+				return
+			default:
+				w.WriteString("ERROR\r\n")
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// get 依次返回每个 key 的值，不存在的 key 不返回任何内容，最后以 END 结束
+func (s *Server) get(w *bufio.Writer, keys []string) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	for _, key := range keys {
+		if len(key) > maxKeyLength {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+	for _, key := range keys {
+		view, err := s.group.Get(key)
+		if errors.Is(err, dcache.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(w, "SERVER_ERROR %s\r\n", oneLine(err))
+			return
+		}
+		fmt.Fprintf(w, "VALUE %s 0 %d\r\n", key, view.Len())
+		view.WriteTo(w)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// set 读取数据块并写入 Group，只有连接读取失败时才返回错误，此时应当关闭连接
+func (s *Server) set(r *bufio.Reader, w *bufio.Writer, args []string) error {
+	if len(args) != 4 && len(args) != 5 {
+		w.WriteString("ERROR\r\n")
+		return nil
+	}
+	noreply := len(args) == 5 && args[4] == "noreply"
+	key := args[0]
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	_, exptimeErr := strconv.ParseInt(args[2], 10, 64)
+	n, bytesErr := strconv.Atoi(args[3])
+	if len(key) > maxKeyLength || flagsErr != nil || exptimeErr != nil || bytesErr != nil || n < 0 ||
+		(len(args) == 5 && !noreply) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+	if n > maxItemSize {
+		// 丢弃数据块，使连接仍然可以继续使用
+		if _, err := io.CopyN(io.Discard, r, int64(n)+2); err != nil {
+			return err
+		}
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if string(data[n:]) != "\r\n" {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return nil
+	}
+	reply := "STORED\r\n"
+	if err := s.group.Set(key, data[:n]); err != nil {
+		reply = fmt.Sprintf("SERVER_ERROR %s\r\n", oneLine(err))
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+	return nil
+}
+
+// oneLine 去掉错误信息中的换行，避免破坏协议的分帧
+func oneLine(err error) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+}
@@ -0,0 +1,133 @@
+package memcachetext
+
+import (
+	"DCache/dcache"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+}
+
+func startServer(t *testing.T, name string) net.Conn {
+	g := dcache.NewGroup(name, 2<<10, dcache.GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%w: %s", dcache.ErrNotFound, key)
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(g)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readValues 解析 get 的响应，返回 key 与值的映射
+func readValues(t *testing.T, r *bufio.Reader) map[string]string {
+	values := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "END\r\n" {
+			return values
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" || fields[2] != "0" {
+			t.Fatalf("unexpected response line %q", line)
+		}
+		n, _ := strconv.Atoi(fields[3])
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		if string(data[n:]) != "\r\n" {
+			t.Fatalf("data block of %s should end with \\r\\n", fields[1])
+		}
+		values[fields[1]] = string(data[:n])
+	}
+}
+
+func TestGet(t *testing.T) {
+	conn := startServer(t, "memcache-get")
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "get Tom\r\n")
+	if values := readValues(t, r); len(values) != 1 || values["Tom"] != "630" {
+		t.Fatalf("expect Tom=630, but got %v", values)
+	}
+	// 不存在的 key 不返回 VALUE
+	fmt.Fprintf(conn, "get Tom unknown Jack\r\n")
+	if values := readValues(t, r); len(values) != 2 || values["Tom"] != "630" || values["Jack"] != "589" {
+		t.Fatalf("expect Tom and Jack, but got %v", values)
+	}
+}
+
+func TestSet(t *testing.T) {
+	conn := startServer(t, "memcache-set")
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "set Sam 0 0 3\r\n567\r\n")
+	if line, _ := r.ReadString('\n'); line != "STORED\r\n" {
+		t.Fatalf("expect STORED, but got %q", line)
+	}
+	fmt.Fprintf(conn, "set Sam 0 0 3 noreply\r\n568\r\nget Sam\r\n")
+	if values := readValues(t, r); values["Sam"] != "568" {
+		t.Fatalf("expect Sam=568, but got %v", values)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	conn := startServer(t, "memcache-errors")
+	r := bufio.NewReader(conn)
+
+	for cmd, expect := range map[string]string{
+		"delete Tom\r\n":            "ERROR\r\n",
+		"get\r\n":                   "ERROR\r\n",
+		"set Sam 0 0 x\r\n":         "CLIENT_ERROR bad command line format\r\n",
+		"set Sam 0 0 3\r\n5678\r\n": "CLIENT_ERROR bad data chunk\r\n",
+		"get " + strings.Repeat("k", maxKeyLength+1) + "\r\n": "CLIENT_ERROR bad command line format\r\n",
+	} {
+		fmt.Fprint(conn, cmd)
+		line, err := r.ReadString('\n')
+		if err != nil || line != expect {
+			t.Fatalf("expect %q for %q, but got %q, %v", expect, cmd, line, err)
+		}
+		if strings.HasSuffix(cmd, "5678\r\n") {
+			// 数据块长度不符时，多出的内容被当作下一条命令
+			r.ReadString('\n')
+		}
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	conn := startServer(t, "memcache-long-line")
+	r := bufio.NewReader(conn)
+
+	// 不发送换行符的客户端在命令行超过上限后被断开，而不是被无限制地缓存
+	fmt.Fprint(conn, "get "+strings.Repeat("k", 2*maxLineLength))
+	if line, err := r.ReadString('\n'); err != nil || line != "CLIENT_ERROR line too long\r\n" {
+		t.Fatalf("expect CLIENT_ERROR line too long, but got %q, %v", line, err)
+	}
+	// 未读完的数据使关闭连接时可能返回 RST，因此只检查连接已不可读
+	if line, err := r.ReadString('\n'); err == nil {
+		t.Fatalf("expect the connection to be closed, but got %q", line)
+	}
+}
@@ -0,0 +1,34 @@
+package dcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Meta describes the value returned by GetWithMeta.
+type Meta struct {
+	Source Source // 值的来源，与 GetWithSource 相同
+	// TTL 为值在本节点缓存中的剩余过期时间，0 表示永不过期或者未知（如从远程节点获取的值）
+	TTL time.Duration
+	// Hash 为值内容的 SHA-256 哈希（十六进制），内容相同的值哈希相同，可用于生成 HTTP 的 ETag
+	Hash string
+}
+
+// GetWithMeta is like GetWithSource, but also returns the remaining TTL and a content hash of the value.
+// 适合在 Group 前面部署 CDN 或者 HTTP 缓存时，由调用方据此设置 Cache-Control 的 max-age 与 ETag
+func (g *Group) GetWithMeta(key string) (ByteView, Meta, error) {
+	value, source, err := g.GetWithSource(key)
+	if err != nil {
+		return ByteView{}, Meta{Source: source}, err
+	}
+	sum := sha256.Sum256(value.b)
+	meta := Meta{Source: source, Hash: hex.EncodeToString(sum[:])}
+	// 剩余过期时间以 mainCache 中的记录为准，回调函数刚加载的值同样已经写入了 mainCache
+	if v, ok := g.mainCache.peek(key); ok && v.version == value.version && !v.deadline.IsZero() {
+		if ttl := time.Until(v.deadline); ttl > 0 {
+			meta.TTL = ttl
+		}
+	}
+	return value, meta, nil
+}
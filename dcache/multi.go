@@ -0,0 +1,194 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 批量获取：将未命中本地缓存的 key 按照一致性哈希选出的节点分组，每个远程节点只发送一次请求，
+// 各节点的请求并发执行，归属于本节点的 key 则回退到本地获取。
+
+// MultiError records the keys which failed in GetMulti and the reasons.
+// 无论 key 归属于本节点还是远程节点，不存在的 key 对应的错误都满足 errors.Is(err, ErrNotFound)
+type MultiError map[string]error
+
+func (e MultiError) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", key, e[key]))
+	}
+	return fmt.Sprintf("failed to get %d keys: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// GetMulti gets values for multiple keys.
+// 返回获取成功的 key 与缓存值；若部分 key 获取失败，同时返回一个 MultiError 描述失败的 key。
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 与 GetMulti 相同，ctx 会传递到回调函数与远程节点的请求中。
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values, err := g.getMulti(ctx, keys, true)
+	return decompressMulti(values, err)
+}
+
+// decompressMulti 解压 getMulti 返回的缓存值，解压失败的 key 同样记录在 MultiError 中
+func decompressMulti(values map[string]ByteView, err error) (map[string]ByteView, error) {
+	failed, _ := err.(MultiError)
+	for key, value := range values {
+		v, e := value.decompress()
+		if e != nil {
+			if failed == nil {
+				failed = make(MultiError)
+			}
+			failed[key] = e
+			delete(values, key)
+			continue
+		}
+		values[key] = v
+	}
+	if failed != nil {
+		return values, failed
+	}
+	return values, err
+}
+
+// getMulti 在 usePeers 为 false 时只从本节点获取，用于响应远程节点的请求
+func (g *Group) getMulti(ctx context.Context, keys []string, usePeers bool) (map[string]ByteView, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		values  = make(map[string]ByteView, len(keys))
+		failed  = make(MultiError)
+		local   []string
+		remotes = make(map[PeerGetter][]string)
+	)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		// 重复的 key 只获取一次
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := g.checkKey(key); err != nil {
+			failed[key] = err
+			continue
+		}
+		if v, ok := g.lookupCache(key); ok {
+			atomic.AddInt64(&g.stats.LocalHits, 1)
+			if v.err != nil {
+				if def, ok := g.defaultFor(v.err); ok {
+					values[key] = def
+				} else {
+					failed[key] = v.err
+				}
+				continue
+			}
+			values[key] = v
+			continue
+		}
+		atomic.AddInt64(&g.stats.Misses, 1)
+		if usePeers && g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				remotes[peer] = append(remotes[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	getLocally := func(key string) {
+		defer wg.Done()
+		value, err := g.getLocally(ctx, key)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if def, ok := g.defaultFor(err); ok {
+				values[key] = def
+			} else {
+				failed[key] = err
+			}
+			return
+		}
+		values[key] = value
+	}
+
+	for peer, peerKeys := range remotes {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			res := &pb.MultiResponse{}
+			err := peer.GetMulti(ctx, &pb.MultiRequest{Group: g.name, Keys: peerKeys}, res)
+			if err != nil {
+				if g.noFallbackLocal {
+					// 关闭回退时与 Get 相同，远程节点的错误直接返回给调用方，不会访问数据源
+					g.logger.Printf("[dcache] Failed to get multi from peer: %v", err)
+					mu.Lock()
+					defer mu.Unlock()
+					for _, key := range peerKeys {
+						failed[key] = err
+					}
+					return
+				}
+				// 远程节点不可用时，回退到本地获取
+				g.logger.Printf("[dcache] Failed to get multi from peer, try to get locally: %v", err)
+				wg.Add(len(peerKeys))
+				for _, key := range peerKeys {
+					go getLocally(key)
+				}
+				return
+			}
+			notFound := make(map[string]bool, len(res.NotFound))
+			for _, key := range res.NotFound {
+				notFound[key] = true
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, key := range peerKeys {
+				if v, ok := res.Values[key]; ok {
+					// 与 Get 相同，校验失败的值不会被使用
+					if err := VerifyChecksum(&pb.Response{Value: v, Checksum: res.Checksums[key]}); err != nil {
+						failed[key] = err
+						continue
+					}
+					atomic.AddInt64(&g.stats.PeerHits, 1)
+					values[key] = ByteView{b: v, version: res.Versions[key]}
+				} else if msg, ok := res.Errors[key]; ok && notFound[key] {
+					// 与 Get 相同，远程节点上不存在的 key 还原为 ErrNotFound
+					err := fmt.Errorf("%w: %s", ErrNotFound, msg)
+					if def, ok := g.defaultFor(err); ok {
+						values[key] = def
+					} else {
+						failed[key] = err
+					}
+				} else if ok {
+					failed[key] = errors.New(msg)
+				} else {
+					failed[key] = errors.New("missing in peer response")
+				}
+			}
+		}(peer, peerKeys)
+	}
+	wg.Add(len(local))
+	for _, key := range local {
+		go getLocally(key)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		atomic.AddInt64(&g.stats.Errors, int64(len(failed)))
+		return values, failed
+	}
+	return values, nil
+}
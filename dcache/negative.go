@@ -0,0 +1,67 @@
+package dcache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 负缓存：回调函数返回 ErrNotFound（或被 ErrorClassifier 判定为可缓存的错误）时，在 mainCache 中写入一个墓碑标记，
+// 过期前对该 key 的读取直接返回该错误，避免不存在的 key 被反复查询时每次都访问数据源。
+
+const (
+	// maxGetterRetries 为暂时性错误的最大重试次数
+	maxGetterRetries = 3
+	// getterRetryBackoff 为第一次重试前等待的时间，之后每次重试前等待的时间加倍
+	getterRetryBackoff = 50 * time.Millisecond
+)
+
+// getterRetry 为回调函数返回暂时性错误时的重试策略，包括第一次调用在内最多调用 maxGetterRetries+1 次
+var getterRetry = retryPolicy{attempts: maxGetterRetries + 1, backoff: getterRetryBackoff}
+
+// ErrorClassifier classifies an error returned by the getter.
+// cache 为 true 的错误（如 key 格式错误等永久性错误）在开启负缓存时会被缓存；
+// retry 为 true 的错误（如数据库超时等暂时性错误）会在等待 getterRetryBackoff 后重新调用回调函数，
+// 每次重试前等待的时间加倍，最多重试 maxGetterRetries 次，避免立即重试加重数据源的负担。
+// 等待期间 ctx 被取消或者超过截止时间时不再重试，直接返回最后一次的错误。
+type ErrorClassifier func(err error) (cache bool, retry bool)
+
+// SetNegativeCacheTTL caches ErrNotFound returned by the getter for ttl, 0 disables negative caching.
+func (g *Group) SetNegativeCacheTTL(ttl time.Duration) {
+	g.negativeTTL = ttl
+}
+
+// SetErrorClassifier sets the classifier of getter errors, nil restores the default behavior:
+// only ErrNotFound is cached, and no error is retried.
+func (g *Group) SetErrorClassifier(classifier ErrorClassifier) {
+	g.classifier = classifier
+}
+
+func (g *Group) classify(err error) (cache, retry bool) {
+	if g.classifier != nil {
+		return g.classifier(err)
+	}
+	return errors.Is(err, ErrNotFound), false
+}
+
+func notFoundError(key string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+// SetDefaultValue makes Get return v instead of ErrNotFound for missing keys, nil restores returning the error.
+// 开启负缓存时，key 不存在的结果同样会被缓存，过期前的读取直接返回默认值而不再访问数据源
+func (g *Group) SetDefaultValue(v []byte) {
+	if v == nil {
+		g.defaultValue = nil
+		return
+	}
+	g.defaultValue = cloneBytes(v)
+}
+
+// defaultFor 在 err 为 ErrNotFound 且设置了默认值时返回默认值
+func (g *Group) defaultFor(err error) (ByteView, bool) {
+	if g.defaultValue == nil || !errors.Is(err, ErrNotFound) {
+		return ByteView{}, false
+	}
+	return ByteView{b: g.defaultValue}, true
+}
@@ -1,14 +1,41 @@
 package dcache
 
-import pb "DCache/dcache/dcachepb"
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+)
 
 type PeerPicker interface {
 	// PickPeer 用于根据传入的 key 选择相应节点 PeerGetter
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// PeerLister 是可选接口，实现了该接口的 PeerPicker 可以列出所有远程节点，用于向整个集群广播请求（如 Group.ClearAll）
+type PeerLister interface {
+	// Peers 返回除本节点外所有远程节点的 PeerGetter
+	Peers() []PeerGetter
+}
+
+// PrimaryPicker 是可选接口，PickPeer 在 key 的多个副本之间分摊读请求时，
+// 写请求（Set、Delete）与 Has 通过 PickPrimary 发往 key 的主节点，即哈希环上的第一个节点
+type PrimaryPicker interface {
+	PickPrimary(key string) (peer PeerGetter, ok bool)
+}
+
 // PeerGetter 是一个节点的客户端
 type PeerGetter interface {
 	// Get 用于从对应 group 查找缓存值。PeerGetter 就对应于流程中的 HTTP 客户端。
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Delete 用于从对应 group 中删除缓存值
+	Delete(ctx context.Context, in *pb.Request) error
+	// Set 用于将 in.Value 写入对应 group 的缓存中
+	Set(ctx context.Context, in *pb.Request) error
+	// GetMulti 用于从对应 group 批量查找缓存值
+	GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error
+	// Clear 用于清空对应 group 的缓存，只使用 in.Group
+	Clear(ctx context.Context, in *pb.Request) error
+	// Has 用于查询对应 group 的缓存中是否存在 key，不会调用回调函数加载，也不返回缓存值
+	Has(ctx context.Context, in *pb.Request) (bool, error)
+	// DeletePrefix 用于删除对应 group 中 key 以 in.Key 开头的所有缓存值，返回删除的数量
+	DeletePrefix(ctx context.Context, in *pb.Request) (int, error)
 }
@@ -0,0 +1,370 @@
+package dcache
+
+import (
+	"DCache/dcache/lru"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// 持久化：将缓存内容写入本地文件，进程重启后通过 LoadSnapshot 重新填充缓存，加快预热。
+//
+// 文件由一次快照与其后追加的日志组成，二者使用相同的记录格式：
+//
+//	flags(1 字节) | key 长度(4 字节) | key | value 长度(4 字节) | value
+//
+// 整数均为大端序。写入缓存的值会追加一条写入记录；被 Delete、Clear 删除或者过期的 key 追加一条删除记录，
+// 因容量不足被淘汰的 key 不会被删除，它的值仍然有效，重新加载时同样受缓存容量的限制。
+// 记录先放入队列，由后台的 goroutine 批量写入文件，不会阻塞读写缓存；队列已满时记录会被丢弃，
+// 并在下一次刷盘时改为写入完整的快照。快照定期重写整个文件，避免日志无限增长。
+//
+// 负缓存以及带有过期时间的记录不会被持久化，避免重启后返回已经过期的数据。
+
+const (
+	recordDelete     byte = 1 << iota // 删除记录，value 为空
+	recordCompressed                  // value 为压缩后的数据
+)
+
+const (
+	persistQueueSize     = 4096        // 等待写入的记录数上限
+	persistBatchSize     = 256         // 累积的记录数达到该值时立即写入文件
+	persistFlushInterval = time.Second // 未达到 persistBatchSize 的记录最多等待的时间
+)
+
+type record struct {
+	flags byte
+	key   string
+	value []byte
+}
+
+// persister 在后台 goroutine 中写入文件，所有对 file 的操作都在该 goroutine 中进行
+type persister struct {
+	g         *Group
+	path      string
+	interval  time.Duration
+	file      *os.File
+	records   chan record
+	batch     []record
+	dirty     atomic.Bool // 有记录因队列已满被丢弃，需要写入完整的快照
+	closed    atomic.Bool
+	snapshots chan chan error
+	closing   chan chan error
+	done      chan struct{} // 后台 goroutine 退出时关闭
+}
+
+// EnablePersistence persists the cache to path asynchronously, and rewrites the whole file every interval.
+// 需要在使用 Group 之前调用；path 中已有的内容会被保留，之后的记录追加在其后，通常先调用 LoadSnapshot 再启用持久化。
+// interval <= 0 时只在调用 Snapshot 时重写文件
+func (g *Group) EnablePersistence(path string, interval time.Duration) error {
+	if g.persister.Load() != nil {
+		return errors.New("persistence is already enabled")
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	p := &persister{
+		g:         g,
+		path:      path,
+		interval:  interval,
+		file:      file,
+		records:   make(chan record, persistQueueSize),
+		snapshots: make(chan chan error),
+		closing:   make(chan chan error),
+		done:      make(chan struct{}),
+	}
+	if !g.persister.CompareAndSwap(nil, p) {
+		file.Close()
+		return errors.New("persistence is already enabled")
+	}
+	g.mainCache.setJournal(g.persistAdd, g.persistRemove)
+	go p.run()
+	return nil
+}
+
+// Snapshot rewrites the persistence file with the current cache contents and waits for it to finish.
+func (g *Group) Snapshot() error {
+	p := g.persister.Load()
+	if p == nil {
+		return errors.New("persistence is not enabled")
+	}
+	reply := make(chan error)
+	select {
+	case p.snapshots <- reply:
+		return <-reply
+	case <-p.done:
+		return errors.New("persistence is closed")
+	}
+}
+
+// ClosePersistence writes the queued records to the file and stops persisting.
+// 关闭后写入缓存的值不会再被持久化，之后可以再次调用 EnablePersistence 重新启用
+func (g *Group) ClosePersistence() error {
+	p := g.persister.Load()
+	if p == nil || !p.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	reply := make(chan error)
+	p.closing <- reply
+	err := <-reply
+	// 后台 goroutine 已经写完剩余的记录并关闭文件
+	g.persister.CompareAndSwap(p, nil)
+	return err
+}
+
+// persistAdd 将写入缓存的值放入队列，不会阻塞。由 mainCache 在持有锁时调用，
+// 保证队列中同一个 key 的写入与删除记录的顺序与缓存的修改顺序一致，重新加载时已删除的 key 不会复活。
+// 负缓存以及带有过期时间的记录不会被持久化
+func (g *Group) persistAdd(key string, value ByteView) {
+	p := g.persister.Load()
+	if p == nil || value.err != nil || !value.expire.IsZero() {
+		return
+	}
+	var flags byte
+	if value.compressed {
+		flags |= recordCompressed
+	}
+	p.enqueue(record{flags: flags, key: key, value: value.b})
+}
+
+// persistRemove 将被 Delete、Clear 删除或者过期的 key 放入队列，因容量不足被淘汰的 key 不会被删除。
+// 与 persistAdd 相同，由 mainCache 在持有锁时调用
+func (g *Group) persistRemove(key string, reason lru.EvictReason) {
+	if p := g.persister.Load(); p != nil && reason != lru.EvictCapacity {
+		p.enqueue(record{flags: recordDelete, key: key})
+	}
+}
+
+func (p *persister) enqueue(r record) {
+	if p.closed.Load() {
+		return
+	}
+	select {
+	case p.records <- r:
+	default:
+		p.dirty.Store(true)
+	}
+}
+
+func (p *persister) run() {
+	defer close(p.done)
+	flush := time.NewTicker(persistFlushInterval)
+	defer flush.Stop()
+	var snapshot <-chan time.Time
+	if p.interval > 0 {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		snapshot = ticker.C
+	}
+	for {
+		select {
+		case r := <-p.records:
+			p.batch = append(p.batch, r)
+			if len(p.batch) >= persistBatchSize {
+				p.logError(p.flush())
+			}
+		case <-flush.C:
+			if p.dirty.Swap(false) {
+				p.logError(p.snapshot())
+			} else {
+				p.logError(p.flush())
+			}
+		case <-snapshot:
+			p.logError(p.snapshot())
+		case reply := <-p.snapshots:
+			reply <- p.snapshot()
+		case reply := <-p.closing:
+			p.drain()
+			err := p.flush()
+			if p.dirty.Load() {
+				err = p.snapshot()
+			}
+			reply <- errors.Join(err, p.file.Close())
+			return
+		}
+	}
+}
+
+func (p *persister) logError(err error) {
+	if err != nil {
+		p.g.logger.Printf("[dcache] Failed to persist %s: %v", p.path, err)
+	}
+}
+
+// drain 将队列中的记录全部取出放入 batch
+func (p *persister) drain() {
+	for {
+		select {
+		case r := <-p.records:
+			p.batch = append(p.batch, r)
+		default:
+			return
+		}
+	}
+}
+
+// flush 将 batch 中的记录追加到文件
+func (p *persister) flush() error {
+	if len(p.batch) == 0 {
+		return nil
+	}
+	w := bufio.NewWriter(p.file)
+	for _, r := range p.batch {
+		if err := writeRecord(w, r); err != nil {
+			return err
+		}
+	}
+	p.batch = p.batch[:0]
+	return w.Flush()
+}
+
+// snapshot 将当前缓存的全部内容写入临时文件，再替换原文件。
+// 队列中的记录已经反映在缓存中，无需再追加，直接丢弃
+func (p *persister) snapshot() error {
+	p.drain()
+	p.batch = p.batch[:0]
+	p.dirty.Store(false)
+
+	tmp := p.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, key := range p.g.mainCache.keys() {
+		value, ok := p.g.mainCache.peek(key)
+		if !ok || value.err != nil || value.ttl > 0 || !value.softExpire.IsZero() || !value.expire.IsZero() {
+			continue
+		}
+		r := record{key: key, value: value.b}
+		if value.compressed {
+			r.flags |= recordCompressed
+		}
+		if err = writeRecord(w, r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// 原文件已被替换，之后的记录追加到新文件中
+	file, err = os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	p.file.Close()
+	p.file = file
+	return nil
+}
+
+// LoadSnapshot populates the cache with the records persisted in path.
+// 文件末尾不完整的记录（如进程在写入时崩溃）会被忽略
+func (g *Group) LoadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		rec, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			g.logger.Printf("[dcache] Ignore truncated record at the end of %s", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.flags&recordDelete != 0 {
+			g.mainCache.remove(rec.key)
+			continue
+		}
+		value := ByteView{b: rec.value, compressed: rec.flags&recordCompressed != 0, version: newVersion()}
+		if err := g.populateCache(rec.key, value); err != nil {
+			g.logger.Printf("[dcache] Failed to load %s from snapshot: %v", rec.key, err)
+		}
+	}
+}
+
+func writeRecord(w io.Writer, r record) error {
+	var header [5]byte
+	header[0] = r.flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(r.key)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, r.key); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(r.value)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(r.value)
+	return err
+}
+
+// readRecord 读取一条记录，文件正好结束时返回 io.EOF，记录不完整时返回 io.ErrUnexpectedEOF
+func readRecord(r io.Reader) (record, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return record{}, err
+	}
+	key, err := readBytes(r, binary.BigEndian.Uint32(header[1:]))
+	if err != nil {
+		return record{}, err
+	}
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return record{}, noEOF(err)
+	}
+	value, err := readBytes(r, binary.BigEndian.Uint32(length[:]))
+	if err != nil {
+		return record{}, err
+	}
+	return record{flags: header[0], key: string(key), value: value}, nil
+}
+
+// maxRecordBytes 为单个 key 或 value 的长度上限，防止损坏的文件导致分配过多的内存
+const maxRecordBytes = 1 << 30
+
+func readBytes(r io.Reader, n uint32) ([]byte, error) {
+	if n > maxRecordBytes {
+		return nil, fmt.Errorf("corrupted record: length %d exceeds %d", n, maxRecordBytes)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, noEOF(err)
+	}
+	return b, nil
+}
+
+// noEOF 将记录中间遇到的 io.EOF 转换为 io.ErrUnexpectedEOF
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"strings"
+	"sync"
+)
+
+// DeletePrefix removes every key starting with prefix cached on this node and returns how many were removed.
+// 适合 key 按照 "tenant:42:" 这样的层级组织、需要一次性失效某一类 key 的场景。被删除的记录同样会触发 OnEvicted。
+// 匹配的 key 分散在哈希环的各个节点上，因此注册的 PeerPicker 实现了 PeerLister 时会把删除广播给所有远程节点，
+// 远程节点删除的数量不计入返回值，广播失败只记录日志
+func (g *Group) DeletePrefix(prefix string) int {
+	n := g.deletePrefixLocally(prefix)
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return n
+	}
+	var wg sync.WaitGroup
+	for _, peer := range lister.Peers() {
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if _, err := peer.DeletePrefix(context.Background(), &pb.Request{Group: g.name, Key: prefix}); err != nil {
+				g.logger.Printf("[dcache] Failed to delete prefix %s on peer: %v", prefix, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return n
+}
+
+// deletePrefixLocally 删除本节点 mainCache、L1 以及热点 key 副本中以 prefix 开头的 key，返回 mainCache 中删除的数量。
+// 先在读锁下收集匹配的 key，再逐个删除，删除时回调 OnEvicted 不会持有锁
+func (g *Group) deletePrefixLocally(prefix string) int {
+	keys := keysWithPrefix(&g.mainCache, prefix)
+	for _, key := range keys {
+		g.removeLocally(key)
+	}
+	for _, c := range []*cache{g.l1, g.hot} {
+		if c == nil {
+			continue
+		}
+		for _, key := range keysWithPrefix(c, prefix) {
+			c.remove(key)
+		}
+	}
+	return len(keys)
+}
+
+// keysWithPrefix 返回 c 中以 prefix 开头的 key，不会更新 key 的访问记录
+func keysWithPrefix(c *cache, prefix string) []string {
+	var keys []string
+	c.rangeEntries(func(key string, _ ByteView) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
@@ -0,0 +1,63 @@
+package dcache
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// 回调函数限流：大量不同的 key 同时未命中时，singleflight 无法合并这些请求，回调函数会瞬间向数据库发出大量查询。
+// 使用令牌桶限制调用回调函数的速率，超出速率的加载会等待令牌，而不是直接失败；等待期间 ctx 被取消则返回 ctx.Err()。
+
+// SetGetterRateLimit limits the getter to rps calls per second with bursts of burst calls, rps <= 0 disables the limit.
+// 重试同样会消耗令牌
+func (g *Group) SetGetterRateLimit(rps int, burst int) {
+	if rps <= 0 {
+		g.limiter = nil
+		return
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	g.limiter = rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// waitGetter 等待回调函数的令牌。等待时间超过 ctx 的截止时间时 rate 会提前返回，此时同样返回 DeadlineExceeded
+func (g *Group) waitGetter(ctx context.Context) error {
+	err := g.limiter.Wait(ctx)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// SetMaxConcurrentLoads limits the number of getter calls running at the same time to n, n <= 0 disables the limit.
+// 与 SetGetterRateLimit 限制速率不同，该方法限制同时进行的加载数，使其不超过数据库连接池的大小。
+// 超出限制的加载排队等待，等待期间 ctx 被取消则返回 ctx.Err()；同一个 key 的加载仍由 singleflight 合并，只占用一个名额
+func (g *Group) SetMaxConcurrentLoads(n int) {
+	if n <= 0 {
+		g.loadSem = nil
+		return
+	}
+	g.loadSem = make(chan struct{}, n)
+}
+
+// acquireLoad 获取一个加载名额，加载结束后调用 release 释放
+func (g *Group) acquireLoad(ctx context.Context) (release func(), err error) {
+	sem := g.loadSem
+	if sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package dcache
+
+import "sync"
+
+// 共享读锁：默认情况下缓存命中同样需要持有互斥锁，因为 LRU 的 Get 需要将记录移动到队尾，读多写少时互斥锁成为瓶颈。
+// 开启后，命中只持有读锁，通过 Peek 读取记录，不修改链表；被访问的 key 记录在有界的缓冲区中，
+// 下一次持有写锁（写入或者未命中）时再依次调用 Get 补上这些访问。缓冲区按 key 的哈希值分为多个条带，
+// 每个条带有独立的锁，并发命中很少竞争同一把锁。条带已满时丢弃访问记录，因此淘汰顺序只是近似的 LRU：
+// 被频繁访问的 key 仍然会被记录，偶尔一次访问被丢弃不影响结果。
+
+const (
+	promotionStripes    = 16 // 缓冲区的条带数
+	promotionStripeSize = 64 // 每个条带缓存的访问记录数上限
+)
+
+type promotionStripe struct {
+	mu   sync.Mutex
+	keys []string
+	_    [64]byte // 避免相邻条带的锁位于同一个缓存行
+}
+
+// promotionBuffer 记录共享读锁下命中的 key
+type promotionBuffer struct {
+	stripes [promotionStripes]promotionStripe
+}
+
+// record 记录一次访问，与条带中上一次记录的 key 相同时不重复记录
+func (b *promotionBuffer) record(key string) {
+	s := &b.stripes[fnv32(key)%promotionStripes]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.keys); n < promotionStripeSize && (n == 0 || s.keys[n-1] != key) {
+		s.keys = append(s.keys, key)
+	}
+}
+
+// drain 取出所有条带中的访问记录并依次交给 fn，持有 cache 的写锁时调用，此时不会有并发的 record
+func (b *promotionBuffer) drain(fn func(key string)) {
+	for i := range b.stripes {
+		s := &b.stripes[i]
+		s.mu.Lock()
+		for _, key := range s.keys {
+			fn(key)
+		}
+		s.keys = s.keys[:0]
+		s.mu.Unlock()
+	}
+}
+
+// SetReadOptimized makes cache hits take a shared read lock instead of the exclusive lock.
+// 读多写少时可以显著提高并发读取的吞吐量，代价是淘汰顺序变为近似的 LRU（LFU 的访问次数同理）。
+// 需要在使用 Group 之前调用
+func (g *Group) SetReadOptimized(enabled bool) {
+	g.mainCache.setReadOptimized(enabled)
+}
+
+// setReadOptimized 开启或关闭共享读锁，分片时设置到每个分片上
+func (c *cache) setReadOptimized(enabled bool) {
+	for _, shard := range c.shards {
+		shard.setReadOptimized(enabled)
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	c.applyPromotions()
+	c.promotions = nil
+	if enabled {
+		c.promotions = &promotionBuffer{}
+	}
+}
+
+// getShared 持有读锁查找 key，命中时记录这次访问，未命中（包括已过期）时返回 false，由调用方持有写锁重新查找
+func (c *cache) getShared(key string) (ByteView, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.policy == nil {
+		return ByteView{}, false
+	}
+	v, ok := c.policy.Peek(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	c.promotions.record(key)
+	return v.(ByteView), true
+}
+
+// applyPromotions 将缓冲区中的访问记录应用到淘汰策略上，需要在持有写锁时调用
+func (c *cache) applyPromotions() {
+	if c.policy == nil || c.promotions == nil {
+		return
+	}
+	c.promotions.drain(func(key string) {
+		c.policy.Get(key)
+	})
+}
@@ -0,0 +1,32 @@
+package dcache
+
+// 读副本：热点 key 的读请求全部落在其归属节点上，会使该节点的 CPU 成为瓶颈。
+// 启用读副本后，读请求在哈希环上 key 之后的 n 个节点（包括本节点）之间随机分摊，每个副本各自缓存该 key；
+// 写请求仍然只发往第一个节点（主节点）。其他副本上的缓存不会随写入更新，在被淘汰或过期之前可能读到旧值，
+// 因此只适合能容忍短暂不一致的读多写少的数据。
+
+// SetReadReplicas spreads reads of a key across the first n peers on the ring, writes always go to the first one.
+// n <= 1 表示只从主节点读取，默认关闭
+func (p *HTTPPool) SetReadReplicas(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readReplicas = n
+}
+
+// PickPrimary picks the primary peer of key, implements PrimaryPicker.
+func (p *HTTPPool) PickPrimary(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	return p.getterLocked(p.peers.Get(key))
+}
+
+// pickPrimary 选择写请求的目标节点，PeerPicker 未实现 PrimaryPicker 时与 PickPeer 相同
+func (g *Group) pickPrimary(key string) (PeerGetter, bool) {
+	if picker, ok := g.peers.(PrimaryPicker); ok {
+		return picker.PickPrimary(key)
+	}
+	return g.peers.PickPeer(key)
+}
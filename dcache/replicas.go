@@ -0,0 +1,59 @@
+package dcache
+
+// 自适应虚拟节点个数：节点较少时每个节点需要更多的虚拟节点，key 才能在节点间均匀分布；
+// 节点较多时总的虚拟节点数已经足够，继续增加只会占用内存并拖慢查找。
+// 开启后每个节点的虚拟节点个数为 adaptiveVirtualNodes / 节点数，并限制在 [defaultReplicas, maxAdaptiveReplicas] 之间。
+// 节点数按照 Set、AddPeers、RemovePeers 配置的节点计算，健康检查暂时移除的节点不影响虚拟节点个数，避免节点抖动时整个哈希环重新分布。
+
+const (
+	adaptiveVirtualNodes = 1000 // 哈希环上期望的虚拟节点总数
+	maxAdaptiveReplicas  = 500  // 节点很少时每个节点虚拟节点个数的上限
+)
+
+// SetAdaptiveReplicas sets whether to derive the number of virtual nodes per peer from the cluster size,
+// instead of HTTPPoolOptions.Replicas.
+// 虚拟节点个数变化时整个哈希环会重建，大部分 key 会被重新映射，与修改 Replicas 后调用 Set 相同；
+// 所有节点需要使用相同的配置，否则各个节点对 key 归属的判断不一致
+func (p *HTTPPool) SetAdaptiveReplicas(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.adaptiveReplicas = enabled
+	p.resizeRing()
+}
+
+// adaptiveReplicas 返回 n 个节点时每个节点的虚拟节点个数
+func adaptiveReplicas(n int) int {
+	if n <= 0 {
+		return maxAdaptiveReplicas
+	}
+	replicas := adaptiveVirtualNodes / n
+	if replicas > maxAdaptiveReplicas {
+		return maxAdaptiveReplicas
+	}
+	if replicas < defaultReplicas {
+		return defaultReplicas
+	}
+	return replicas
+}
+
+// replicas 返回 n 个节点时哈希环使用的虚拟节点个数
+func (p *HTTPPool) replicas(n int) int {
+	if !p.adaptiveReplicas {
+		return p.opts.Replicas
+	}
+	return adaptiveReplicas(n)
+}
+
+// resizeRing 在虚拟节点个数需要变化时重建哈希环，被健康检查移除的节点不会加入，需要在持有 p.mu 时调用
+func (p *HTTPPool) resizeRing() {
+	if p.peers == nil || p.peers.Replicas() == p.replicas(len(p.httpGetters)) {
+		return
+	}
+	ring := p.newRing(len(p.httpGetters))
+	for peer := range p.httpGetters {
+		if !p.unhealthy[peer] {
+			ring.Add(peer)
+		}
+	}
+	p.peers = ring
+}
@@ -0,0 +1,41 @@
+package dcache
+
+import (
+	"context"
+	"time"
+)
+
+// 重试：远程节点偶尔的连接错误或 5xx 会使 Group 立即回退到本地获取，大量 key 同时回退时会压垮数据源。
+// Get 是幂等的，因此在回退之前先对同一节点重试几次，每次重试前等待的时间按指数增长。
+// 404 说明 key 不存在，不会重试；Set、Delete 等写请求也不会重试。
+
+// SetPeerRetry makes a Get to a peer retry up to attempts times in total on connection errors and 5xx,
+// waiting backoff before the first retry and doubling it before each of the next ones.
+// attempts <= 1 表示不重试，默认不重试。与熔断器同时使用时，每次重试同样计入连续失败的次数
+func (p *HTTPPool) SetPeerRetry(attempts int, backoff time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retry = retryPolicy{attempts: attempts, backoff: backoff}
+	p.refreshGettersLocked()
+}
+
+type retryPolicy struct {
+	attempts int // 包括第一次请求在内的最大请求次数
+	backoff  time.Duration
+}
+
+// wait 在第 attempt 次请求失败后判断是否重试，需要重试时等待退避时间后返回 true。
+// 已经达到最大请求次数，或者等待期间 ctx 被取消时返回 false
+func (r retryPolicy) wait(ctx context.Context, attempt int) bool {
+	if attempt >= r.attempts {
+		return false
+	}
+	timer := time.NewTimer(r.backoff << (attempt - 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
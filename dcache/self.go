@@ -0,0 +1,72 @@
+package dcache
+
+import (
+	"net"
+	"net/url"
+)
+
+// 本节点识别：PickPeer 选出的节点与本节点的地址相同时，key 在本地获取。默认按照字符串严格比较，
+// 同一个节点可能以不同的地址出现在节点列表中（如注册时使用 localhost，服务发现返回 127.0.0.1），
+// 此时节点认不出自己，会通过网络把请求转发给自己，又再次转发，直到超时。
+
+// SetSelfMatcher sets the function which reports whether peer is the address of this node, nil means exact equality.
+// 例如 p.SetSelfMatcher(dcache.SameAddr)
+func (p *HTTPPool) SetSelfMatcher(fn func(self, peer string) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.selfMatcher = fn
+}
+
+// isSelf 判断 peer 是否为本节点，需要在持有 p.mu 时调用
+func (p *HTTPPool) isSelf(peer string) bool {
+	if p.selfMatcher == nil {
+		return peer == p.self
+	}
+	return p.selfMatcher(p.self, peer)
+}
+
+// SameAddr reports whether a and b are the same HTTP address, loopback aliases such as
+// localhost, 127.0.0.1 and ::1 are treated as the same host.
+// 省略的端口按照 scheme 的默认端口比较，无法解析的地址按照字符串比较
+func SameAddr(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	if ua.Scheme != ub.Scheme || ua.Path != ub.Path || ua.Host == "" || ub.Host == "" {
+		return false
+	}
+	return portOf(ua) == portOf(ub) && sameHost(ua.Hostname(), ub.Hostname())
+}
+
+func portOf(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+func sameHost(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return isLoopback(a) && isLoopback(b)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
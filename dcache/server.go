@@ -0,0 +1,159 @@
+package dcache
+
+import (
+	pb "DCache/dcache/dcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// 节点间通信的服务端逻辑，与具体的传输协议无关，HTTPPool 与 grpcpool 都基于这些函数响应远程节点的请求。
+// 远程节点只会把请求发给 key 的归属节点，因此这些函数只作用于本节点，不会再次转发给其他节点，避免请求在节点间循环。
+
+// ErrNoSuchGroup is returned when a peer requests a group which does not exist.
+var ErrNoSuchGroup = errors.New("no such group")
+
+// ErrChecksumMismatch is returned when the value received from a peer does not match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyChecksum verifies out.Value against out.Checksum, responses without a checksum are accepted.
+// 客户端在使用远程节点返回的缓存值之前调用，校验失败的缓存值不会被写入缓存
+func VerifyChecksum(out *pb.Response) error {
+	if out.Checksum == 0 {
+		return nil
+	}
+	if sum := crc32.ChecksumIEEE(out.Value); sum != out.Checksum {
+		return fmt.Errorf("%w: expect %08x, got %08x", ErrChecksumMismatch, out.Checksum, sum)
+	}
+	return nil
+}
+
+func lookupGroup(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchGroup, name)
+	}
+	return group, nil
+}
+
+// ServeGet looks up in.Key in the local cache of in.Group, loading it with the getter on a miss.
+func ServeGet(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveGet(ctx, in, out)
+}
+
+// ServeDelete removes in.Key from the local cache of in.Group.
+func ServeDelete(ctx context.Context, in *pb.Request) error {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	group.removeLocally(in.Key)
+	return nil
+}
+
+// ServeClear removes all keys from the local cache of in.Group.
+func ServeClear(ctx context.Context, in *pb.Request) error {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	group.Clear()
+	return nil
+}
+
+// ServeSet stores in.Value for in.Key in the local cache of in.Group.
+func ServeSet(ctx context.Context, in *pb.Request) error {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveSet(in)
+}
+
+// ServeGetMulti looks up in.Keys in the local cache of in.Group, failed keys are reported in out.Errors.
+func ServeGetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return err
+	}
+	return group.serveGetMulti(ctx, in, out)
+}
+
+// ServeHas reports whether in.Key is cached locally in in.Group, the key is never loaded.
+func ServeHas(ctx context.Context, in *pb.Request) (bool, error) {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return false, err
+	}
+	return group.hasLocally(in.Key), nil
+}
+
+// ServeDeletePrefix removes the keys starting with in.Key from the local cache of in.Group.
+func ServeDeletePrefix(ctx context.Context, in *pb.Request) (int, error) {
+	group, err := lookupGroup(in.Group)
+	if err != nil {
+		return 0, err
+	}
+	return group.deletePrefixLocally(in.Key), nil
+}
+
+func (g *Group) serveGet(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	view, _, err := g.get(ctx, in.Key, false)
+	if err != nil {
+		return err
+	}
+	if in.AcceptCompressed {
+		view = g.maybeCompress(view)
+	} else if view, err = view.decompress(); err != nil {
+		// 不支持压缩的客户端（如旧版本的节点）只接收原始数据
+		return err
+	}
+	out.Value = view.ByteSlice()
+	out.Compressed = view.compressed
+	out.Version = view.version
+	out.Checksum = crc32.ChecksumIEEE(out.Value)
+	return nil
+}
+
+func (g *Group) serveSet(in *pb.Request) error {
+	if err := g.checkKey(in.Key); err != nil {
+		return err
+	}
+	version := in.Version
+	if version == 0 {
+		// 旧版本的节点不会携带版本号，视为最新的写入
+		version = newVersion()
+	}
+	return g.populateCache(in.Key, ByteView{b: cloneBytes(in.Value), version: version})
+}
+
+func (g *Group) serveGetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	values, err := decompressMulti(g.getMulti(ctx, in.Keys, false))
+	out.Values = make(map[string][]byte, len(values))
+	out.Versions = make(map[string]int64, len(values))
+	out.Checksums = make(map[string]uint32, len(values))
+	for key, view := range values {
+		out.Values[key] = view.ByteSlice()
+		out.Versions[key] = view.version
+		out.Checksums[key] = crc32.ChecksumIEEE(out.Values[key])
+	}
+	if err != nil {
+		failed, ok := err.(MultiError)
+		if !ok {
+			return err
+		}
+		out.Errors = make(map[string]string, len(failed))
+		for key, e := range failed {
+			out.Errors[key] = e.Error()
+			if errors.Is(e, ErrNotFound) {
+				out.NotFound = append(out.NotFound, key)
+			}
+		}
+	}
+	return nil
+}
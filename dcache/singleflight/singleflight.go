@@ -1,12 +1,35 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // call 代表正在进行中，或者已经结束的请求
+// done 在请求结束时被关闭，等待者可以同时监听 ctx.Done()，从而支持取消
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{}
+	val  interface{}
+	err  error
+	// mu 使 commit 与 Forget 互斥，只保护 forgotten。每个请求拥有自己的锁，不同 key 的 commit 可以并发执行
+	mu        sync.Mutex
+	forgotten bool // 请求进行中时调用了 Forget
+	dups      int  // 等待该请求结果的其他调用者数量，由 Group.mu 保护
+	// chans 为通过 DoChan 等待结果的调用者，请求结束时结果会发送到每个 chan 中
+	chans []chan<- Result
+	// waiters 为仍在等待结果的调用者数量（包括发起请求的调用者），由 Group.mu 保护。
+	// 通过 DoCommitContext 发起的请求在 waiters 减为 0 时调用 cancel 取消 fn 的 ctx
+	waiters int
+	ctx     context.Context // fn 的 ctx，只有通过 DoCommitContext 发起的请求才有
+	cancel  context.CancelFunc
+}
+
+// Result holds the results of DoChan.
+// Shared 表示结果是否同时返回给了多个调用者
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
 }
 
 // Group 是singleflight的主数据结构，管理不同key的请求
@@ -16,25 +39,196 @@ type Group struct {
 }
 
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoContext(context.Background(), key, fn)
+}
+
+// DoContext 与 Do 相同，但等待其他请求结果的调用者会在 ctx 被取消时立即返回 ctx.Err()。
+// 正在执行 fn 的调用者需要由 fn 自身响应取消。
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoCommit(ctx, key, fn, nil)
+}
+
+// DoCommit 与 DoContext 相同，fn 成功返回后，如果期间没有对 key 调用过 Forget，则调用 commit。
+// commit 与同一个 key 的 Forget 互斥，调用方可以借此将结果写回缓存，而不必担心写回一个已被删除的 key；
+// 不同 key 的 commit 互不阻塞，因此 commit 中可以执行压缩等较慢的操作。
+func (g *Group) DoCommit(ctx context.Context, key string, fn func() (interface{}, error), commit func(interface{})) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		g.mu.Unlock()
+		return g.wait(ctx, key, c)
+	}
+	c := &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+	}
+	g.m[key] = c
+	g.mu.Unlock()
+	g.doCall(c, key, fn, commit)
+	return c.val, c.err
+}
+
+// DoCommitContext 与 DoCommit 相同，但 fn 在单独的 goroutine 中执行，所有调用者都可以在 ctx 被取消时立即返回 ctx.Err()。
+// fn 的 ctx 保留发起请求的调用者的截止时间与值，但不会随该调用者取消，结果仍然返回给其他等待的调用者；
+// 所有等待的调用者都离开后 fn 的 ctx 才被取消，key 同时被忘记，之后的调用会重新执行 fn。
+func (g *Group) DoCommitContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error), commit func(interface{})) (interface{}, error) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
 		g.mu.Unlock()
-		c.wg.Wait()
+		return g.wait(ctx, key, c)
+	}
+	fnCtx, cancel := detach(ctx)
+	c := &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+		ctx:     fnCtx,
+		cancel:  cancel,
+	}
+	g.m[key] = c
+	g.mu.Unlock()
+	go func() {
+		defer cancel()
+		g.doCall(c, key, func() (interface{}, error) { return fn(fnCtx) }, commit)
+	}()
+	return g.wait(ctx, key, c)
+}
+
+// expiresBy 判断 fnCtx 是否不晚于 ctx 的截止时间过期。此时 fnCtx 已经或即将因截止时间而结束，
+// 不再主动取消，使 fn 看到的错误是 context.DeadlineExceeded 而不是 context.Canceled
+func expiresBy(fnCtx, ctx context.Context) bool {
+	fnDeadline, ok := fnCtx.Deadline()
+	if !ok {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && ctx.Err() == context.DeadlineExceeded && !fnDeadline.After(deadline)
+}
+
+// detach 返回一个不会随 ctx 取消的 context，但保留 ctx 的截止时间与其中的值（如 trace span）
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+// wait 等待 c 结束，ctx 被取消时离开并返回 ctx.Err()。最后一个等待的调用者离开时取消可以取消的请求
+func (g *Group) wait(ctx context.Context, key string, c *call) (interface{}, error) {
+	select {
+	case <-c.done:
 		return c.val, c.err
+	case <-ctx.Done():
+	}
+	g.mu.Lock()
+	c.waiters--
+	if c.waiters == 0 && c.cancel != nil {
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		if !expiresBy(c.ctx, ctx) {
+			c.cancel()
+		}
+	}
+	g.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+// DoChan 与 Do 相同，但不会阻塞，而是返回一个在请求结束时收到结果的 chan。
+// 调用方可以同时监听 ctx.Done()，取消后直接返回，fn 在单独的 goroutine 中继续执行，结果仍然返回给其他调用者。
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	return g.DoCommitChan(key, fn, nil)
+}
+
+// DoCommitChan 与 DoChan 相同，fn 成功返回后与 DoCommit 一样调用 commit
+func (g *Group) DoCommitChan(key string, fn func() (interface{}, error), commit func(interface{})) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		// 通过 chan 等待的调用者无法离开，因此一直计入 waiters，请求不会被取消
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
 	}
 	c := &call{
-		wg: sync.WaitGroup{},
+		done:    make(chan struct{}),
+		chans:   []chan<- Result{ch},
+		waiters: 1,
 	}
 	g.m[key] = c
-	c.wg.Add(1)
 	g.mu.Unlock()
+	go g.doCall(c, key, fn, commit)
+	return ch
+}
+
+// doCall 执行 fn 并通知所有等待的调用者。c 只有在 g.m 中时才会有新的等待者，
+// 因此将 c 从 g.m 中删除之后，c.chans 不会再发生变化。
+// commit 只持有 c.mu 而不是 g.mu，加锁顺序总是先 g.mu 后 c.mu，避免死锁
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error), commit func(interface{})) {
 	c.val, c.err = fn()
-	c.wg.Done()
+	c.mu.Lock()
+	if !c.forgotten && c.err == nil && commit != nil {
+		commit(c.val)
+	}
+	c.mu.Unlock()
 	g.mu.Lock()
-	delete(g.m, key)
+	if g.m[key] == c {
+		// 被 Forget 之后 key 可能已经对应一个新的请求
+		delete(g.m, key)
+	}
+	chans, shared := c.chans, c.dups > 0
 	g.mu.Unlock()
-	return c.val, c.err
+	close(c.done)
+	for _, ch := range chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: shared}
+	}
+}
+
+// Forget 让 singleflight 忘记正在进行中的 key：之后对该 key 的调用会重新执行 fn，而不是等待之前的请求，
+// 之前的请求结束后也不会再调用 commit；如果 commit 正在执行，Forget 会等待它返回。
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	c, ok := g.m[key]
+	if ok {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+	if ok {
+		c.forget()
+	}
+}
+
+// ForgetAll 对所有正在进行中的 key 调用 Forget
+func (g *Group) ForgetAll() {
+	g.mu.Lock()
+	calls := make([]*call, 0, len(g.m))
+	for key, c := range g.m {
+		calls = append(calls, c)
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+	for _, c := range calls {
+		c.forget()
+	}
+}
+
+// forget 标记请求已被 Forget，等待正在执行的 commit 返回
+func (c *call) forget() {
+	c.mu.Lock()
+	c.forgotten = true
+	c.mu.Unlock()
 }
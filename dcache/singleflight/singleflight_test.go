@@ -0,0 +1,203 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v.(string) != "bar" || err != nil {
+		t.Fatalf("Do v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	go g.Do("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	time.Sleep(10 * time.Millisecond) // 等待第一个请求开始执行
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := g.DoContext(ctx, "key", func() (interface{}, error) {
+		t.Fatal("fn should not be called for duplicate key")
+		return nil, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+	close(release)
+}
+
+func TestDoChanCancel(t *testing.T) {
+	var g Group
+	var calls int
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		calls++
+		<-release
+		return "bar", nil
+	}
+
+	// 多个调用者等待同一个请求，其中一个取消后立即返回
+	var wg sync.WaitGroup
+	results := make(chan Result, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- <-g.DoChan("key", fn)
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := g.DoChan("key", fn)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-ch:
+		t.Fatalf("the request should still be in flight")
+	case <-ctx.Done():
+	}
+
+	// 请求继续执行，其他调用者仍然收到结果
+	close(release)
+	wg.Wait()
+	close(results)
+	for res := range results {
+		if res.Val.(string) != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("expect a shared result bar, but got %+v", res)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect fn to be called once, but got %d", calls)
+	}
+}
+
+func TestDoCommitContextCancel(t *testing.T) {
+	var g Group
+	entered := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(entered)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.DoCommitContext(ctx1, "key", fn, nil)
+		errs <- err
+	}()
+	<-entered
+	go func() {
+		_, err := g.DoCommitContext(ctx2, "key", func(ctx context.Context) (interface{}, error) {
+			t.Error("fn should not be called for duplicate key")
+			return nil, nil
+		}, nil)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // 等待第二个调用者加入
+
+	// 还有调用者在等待时，fn 的 ctx 不会被取消
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expect %v, but got %v", context.Canceled, err)
+	}
+	g.mu.Lock()
+	c := g.m["key"]
+	g.mu.Unlock()
+	if c == nil || c.waiters != 1 {
+		t.Fatalf("expect the call to stay in flight for the remaining caller")
+	}
+	// 最后一个调用者离开后 fn 的 ctx 被取消，key 被忘记
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expect %v, but got %v", context.Canceled, err)
+	}
+	<-c.done
+	if c.err != context.Canceled {
+		t.Fatalf("expect fn to see a cancelled ctx, but got %v", c.err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	committed := make(chan interface{}, 1)
+	go g.DoCommit(context.Background(), "key", func() (interface{}, error) {
+		close(entered)
+		<-release
+		return "stale", nil
+	}, func(v interface{}) {
+		committed <- v
+	})
+	<-entered
+
+	g.Forget("key")
+	// Forget 之后的调用不会等待之前的请求
+	if v, _ := g.Do("key", func() (interface{}, error) {
+		return "fresh", nil
+	}); v.(string) != "fresh" {
+		t.Fatalf("call after Forget should run fn again, but got %v", v)
+	}
+
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case v := <-committed:
+		t.Fatalf("forgotten call should not commit, but committed %v", v)
+	default:
+	}
+}
+
+func TestCommitDoesNotBlockOtherKeys(t *testing.T) {
+	var g Group
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	go g.DoCommit(context.Background(), "slow", func() (interface{}, error) {
+		return "slow", nil
+	}, func(interface{}) {
+		close(entered)
+		<-release // 模拟一个很慢的写回
+	})
+	<-entered
+
+	// 其他 key 的请求与 commit 不会等待 slow 的 commit
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.DoCommit(context.Background(), "fast", func() (interface{}, error) {
+			return "fast", nil
+		}, func(interface{}) {})
+		g.Forget("other")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("commit of another key should not block")
+	}
+
+	// 同一个 key 的 Forget 等待 commit 返回
+	forgotten := make(chan struct{})
+	go func() {
+		g.Forget("slow")
+		close(forgotten)
+	}()
+	select {
+	case <-forgotten:
+		t.Fatalf("Forget should wait for the running commit of the same key")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-forgotten
+}
@@ -0,0 +1,58 @@
+package dcache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 缓存值大小限制：单条记录超过缓存的容量时，写入后会立即把整个缓存（包括它自己）淘汰掉。
+// 因此超过限制的值不会写入缓存，Get 仍然返回回调函数获取到的值，Set 则返回 ErrValueTooLarge。
+
+// ErrValueTooLarge is returned when a value is too large to be cached.
+var ErrValueTooLarge = errors.New("value too large")
+
+// ErrKeyTooLarge is returned when a key is longer than the limit set by SetMaxKeyBytes.
+var ErrKeyTooLarge = errors.New("key too large")
+
+// defaultMaxKeyBytes 为 key 长度的默认上限。key 同样存储在缓存中并计入占用的内存，
+// 不限制长度时，恶意或有 bug 的客户端可以用超长的 key 耗尽内存
+const defaultMaxKeyBytes = 8 << 10
+
+// SetMaxValueBytes sets the max size of a cached entry (key and value), 0 means only limited by the cache size.
+// 无论是否设置，超过缓存容量（分片时为单个分片的容量）的记录都不会被缓存
+func (g *Group) SetMaxValueBytes(n int64) {
+	g.maxValueBytes = n
+}
+
+// SetMaxKeyBytes sets the max length of keys in bytes, n <= 0 disables the limit, default is 8KB.
+// 超过限制的 key 在访问缓存与回调函数之前就被拒绝，返回 ErrKeyTooLarge
+func (g *Group) SetMaxKeyBytes(n int) {
+	if n < 0 {
+		n = 0
+	}
+	g.maxKeyBytes = n
+}
+
+// checkKey 检查 key 是否为空或者超过长度限制，错误信息中不包含 key 本身，避免输出超长的 key
+func (g *Group) checkKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.maxKeyBytes > 0 && len(key) > g.maxKeyBytes {
+		return fmt.Errorf("%w: key is %d bytes, limit is %d bytes", ErrKeyTooLarge, len(key), g.maxKeyBytes)
+	}
+	return nil
+}
+
+// checkSize 检查 key, value 是否能被缓存，value 应当是压缩后的数据。与 checkKey 相同，错误信息中不包含 key 本身
+func (g *Group) checkSize(key string, value ByteView) error {
+	size := int64(len(key)) + int64(value.Len())
+	limit := g.mainCache.maxEntryBytes()
+	if g.maxValueBytes > 0 && (limit == 0 || g.maxValueBytes < limit) {
+		limit = g.maxValueBytes
+	}
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: entry is %d bytes (key %d bytes), limit is %d bytes", ErrValueTooLarge, size, len(key), limit)
+	}
+	return nil
+}
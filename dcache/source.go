@@ -0,0 +1,35 @@
+package dcache
+
+import "context"
+
+// Source describes where the value returned by GetWithSource came from.
+type Source int
+
+const (
+	SourceLocalCache Source = iota // 命中本节点的缓存
+	SourcePeer                     // 从远程节点获取
+	SourceGetter                   // 调用回调函数从数据源获取
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceLocalCache:
+		return "local"
+	case SourcePeer:
+		return "peer"
+	case SourceGetter:
+		return "getter"
+	}
+	return "unknown"
+}
+
+// GetWithSource is like Get, but also returns where the value came from.
+// 可用于调试或统计各个来源的占比；获取失败时 Source 为失败时所处的阶段
+func (g *Group) GetWithSource(key string) (ByteView, Source, error) {
+	value, source, err := g.get(context.Background(), key, true)
+	if err != nil {
+		return ByteView{}, source, err
+	}
+	value, err = value.decompress()
+	return value, source, err
+}
@@ -0,0 +1,104 @@
+package dcache
+
+import (
+	"context"
+	"time"
+)
+
+// stale-while-revalidate：每条记录有软过期(soft)与硬过期(hard)两个时间。
+// 软过期后的读取立即返回旧值，同时在后台调用回调函数刷新缓存（由 singleflight 去重）；
+// 硬过期后记录从缓存中删除，读取需要阻塞等待重新加载。
+
+// SetStaleWhileRevalidate serves values older than soft while refreshing them in background,
+// values older than hard are evicted. 0 disables stale-while-revalidate.
+func (g *Group) SetStaleWhileRevalidate(soft, hard time.Duration) {
+	if soft > hard {
+		panic("soft expiry must not be later than hard expiry")
+	}
+	g.softTTL, g.hardTTL = soft, hard
+}
+
+// lookupCache 从 mainCache 中查找 key，如果记录已经软过期，则在后台刷新
+// 开启 serveStaleOnError 时，过期的值同样视为未命中
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	v, ok := g.mainCache.get(key)
+	if ok && v.expired(time.Now()) {
+		return ByteView{}, false
+	}
+	if ok && !v.softExpire.IsZero() && time.Now().After(v.softExpire) {
+		go g.revalidate(key)
+	}
+	return v, ok
+}
+
+// revalidate 在后台重新加载 key，加载期间对同一个 key 的刷新只会执行一次
+func (g *Group) revalidate(key string) {
+	if err := g.Refresh(key); err != nil {
+		g.logger.Printf("[dcache] Failed to revalidate %s: %v", key, err)
+	}
+}
+
+// Refresh reloads key with the getter and replaces the cached value in place.
+// 与 Delete 后再 Get 不同，刷新期间旧值一直留在缓存中，读取不会未命中；并发的刷新由 singleflight 去重。
+// 只刷新本节点的缓存，加载失败时保留旧值
+func (g *Group) Refresh(key string) error {
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	_, err := g.getLocally(context.Background(), key)
+	return err
+}
+
+// GetFresh gets the value for a key from the getter, bypassing the local cache and peers.
+// 用于管理后台强制刷新，获取到的值同样会写回本节点的缓存；与同一个 key 正在进行中的加载会被合并
+func (g *Group) GetFresh(key string) (ByteView, error) {
+	if err := g.checkKey(key); err != nil {
+		return ByteView{}, err
+	}
+	value, err := g.getLocally(context.Background(), key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return value.decompress()
+}
+
+// SetServeStaleOnError serves the last cached value instead of the error when the getter fails to reload an expired key.
+// 开启后，带有过期时间的值在过期后不会被删除，而是一直保留到重新加载成功或者因容量不足被淘汰；
+// 过期的值只在加载失败时返回，ByteView.Stale 为 true。ErrNotFound 等可缓存的错误说明数据已不存在，仍然返回错误。
+// 只影响开启之后写入的值
+func (g *Group) SetServeStaleOnError(enabled bool) {
+	g.serveStaleOnError = enabled
+}
+
+// addExpiring 写入在 ttl 后过期的值。开启 serveStaleOnError 时由 Group 记录过期时间，淘汰策略不会删除过期的值，返回值是否被写入
+func (g *Group) addExpiring(key string, value ByteView, ttl time.Duration) bool {
+	if ttl > 0 {
+		value.deadline = time.Now().Add(ttl)
+	}
+	if g.serveStaleOnError && ttl > 0 {
+		value.expire = value.deadline
+		return g.mainCache.add(key, value)
+	}
+	return g.mainCache.addWithTTL(key, value, ttl)
+}
+
+// staleOnError 在加载 key 失败时返回缓存中过期的值，请求被取消或者错误可缓存时返回 false
+func (g *Group) staleOnError(ctx context.Context, key string, err error) (ByteView, bool) {
+	if !g.serveStaleOnError || ctx.Err() != nil {
+		return ByteView{}, false
+	}
+	if cacheable, _ := g.classify(err); cacheable {
+		return ByteView{}, false
+	}
+	v, ok := g.mainCache.peek(key)
+	if !ok || v.err != nil || v.expire.IsZero() {
+		return ByteView{}, false
+	}
+	g.logger.Printf("[dcache] Failed to reload %s, serve stale value: %v", key, err)
+	v.stale = true
+	return v, true
+}
+
+func (v ByteView) expired(now time.Time) bool {
+	return !v.expire.IsZero() && now.After(v.expire)
+}
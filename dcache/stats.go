@@ -0,0 +1,61 @@
+package dcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// 节点状态查询：运维人员可以通过 curl http://<host>/<basepath>/_stats 查看本节点上所有 group 的命中情况、
+// 缓存的记录条数与内存占用，以及本节点已知的远程节点。
+
+const statsPath = "_stats" // 状态查询的访问路径为 /<basepath>/_stats
+
+// GroupStats is the state of a group on this node reported by the stats endpoint.
+type GroupStats struct {
+	Stats
+	Entries  int   `json:"entries"`   // 本节点缓存的记录条数
+	Bytes    int64 `json:"bytes"`     // 本节点缓存使用的内存字节数
+	MaxBytes int64 `json:"max_bytes"` // 本节点缓存最多使用的内存字节数，0 表示不限制
+}
+
+// PoolStats is the response of the stats endpoint.
+type PoolStats struct {
+	Self      string                `json:"self"`
+	Peers     []string              `json:"peers"`     // 所有已知的节点
+	Unhealthy []string              `json:"unhealthy"` // 被健康检查移出哈希环的节点
+	Groups    map[string]GroupStats `json:"groups"`
+}
+
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	stats := PoolStats{
+		Self:      p.self,
+		Peers:     make([]string, 0, len(p.httpGetters)),
+		Unhealthy: make([]string, 0, len(p.unhealthy)),
+		Groups:    make(map[string]GroupStats),
+	}
+	for peer := range p.httpGetters {
+		stats.Peers = append(stats.Peers, peer)
+	}
+	for peer := range p.unhealthy {
+		stats.Unhealthy = append(stats.Unhealthy, peer)
+	}
+	p.mu.Unlock()
+	sort.Strings(stats.Peers)
+	sort.Strings(stats.Unhealthy)
+
+	mu.RLock()
+	for name, g := range groups {
+		stats.Groups[name] = GroupStats{
+			Stats:    g.Stats(),
+			Entries:  g.mainCache.len(),
+			Bytes:    g.CacheBytes(),
+			MaxBytes: g.MaxBytes(),
+		}
+	}
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
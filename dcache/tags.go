@@ -0,0 +1,124 @@
+package dcache
+
+import (
+	"DCache/dcache/lru"
+	"sync"
+)
+
+// 标签：写入时可以为 key 打上多个标签（如 "user:5"、"org:3"），之后通过 InvalidateTag 一次删除带有某个标签的所有 key。
+// 标签的反向索引只保存在本节点，与 DeletePrefix 不同，SetWithTags 与 InvalidateTag 都只作用于本节点的缓存。
+// key 被淘汰、删除或者过期时同时从索引中删除；通过 Set 等方式覆盖写入不会清除 key 已有的标签。
+
+// tagIndex 维护标签到 key 以及 key 到标签的双向索引
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{} // 标签对应的 key
+	tags map[string]taggedKey           // key 对应的标签
+}
+
+// taggedKey 为 key 的标签，以及打上标签时写入的值的版本。
+// 淘汰的回调在释放缓存的锁之后才执行，只删除版本一致的索引，避免删掉之后重新写入的 key 的标签
+type taggedKey struct {
+	tags    []string
+	version int64
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{keys: make(map[string]map[string]struct{}), tags: make(map[string]taggedKey)}
+}
+
+// set 将 key 的标签替换为 tags
+func (t *tagIndex) set(key string, tags []string, version int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+	if len(tags) == 0 {
+		return
+	}
+	t.tags[key] = taggedKey{tags: tags, version: version}
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// remove 删除 key 的标签，version 与打上标签时的版本不一致时不删除
+func (t *tagIndex) remove(key string, version int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tk, ok := t.tags[key]; ok && tk.version == version {
+		t.removeLocked(key)
+	}
+}
+
+// removeLocked 需要在持有 t.mu 时调用
+func (t *tagIndex) removeLocked(key string) {
+	tk, ok := t.tags[key]
+	if !ok {
+		return
+	}
+	delete(t.tags, key)
+	for _, tag := range tk.tags {
+		delete(t.keys[tag], key)
+		if len(t.keys[tag]) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+}
+
+// keysOf 返回带有 tag 的所有 key 的快照
+func (t *tagIndex) keysOf(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.keys[tag]))
+	for key := range t.keys[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SetWithTags stores value for key in the cache of this node and associates it with tags.
+// 再次调用会替换 key 已有的标签，tags 为空时清除 key 的标签
+func (g *Group) SetWithTags(key string, value []byte, tags []string) error {
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	index := g.initTags()
+	view := ByteView{b: cloneBytes(value), version: newVersion()}
+	added, err := g.addToCache(key, view)
+	if err != nil || !added {
+		// 缓存中已有更新的值时不记录标签，否则之后的 InvalidateTag 会删除这个没有标签的新值
+		return err
+	}
+	index.set(key, append([]string(nil), tags...), view.version)
+	return nil
+}
+
+// InvalidateTag removes every key tagged with tag from the cache of this node and returns how many were removed.
+func (g *Group) InvalidateTag(tag string) int {
+	keys := g.initTags().keysOf(tag)
+	for _, key := range keys {
+		g.removeLocally(key)
+	}
+	return len(keys)
+}
+
+// initTags 在第一次使用标签时创建索引，并注册淘汰回调以便同步清理索引
+func (g *Group) initTags() *tagIndex {
+	g.tagsOnce.Do(func() {
+		g.tags = newTagIndex()
+		g.mainCache.setOnEvicted(g.handleEvicted)
+	})
+	return g.tags
+}
+
+// handleEvicted 为 mainCache 的淘汰回调，通知标签索引
+func (g *Group) handleEvicted(key string, value ByteView, reason lru.EvictReason) {
+	if g.tags != nil {
+		g.tags.remove(key, value.version)
+	}
+}
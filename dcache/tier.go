@@ -0,0 +1,25 @@
+package dcache
+
+import "strconv"
+
+// 多层节点：例如同时部署了主集群和异地的只读副本集群时，读取先访问本地集群，未命中或失败时再访问副本集群，
+// 所有层级都失败后才回退到本地调用回调函数。某一层的节点确认 key 不存在（ErrNotFound）时仍会尝试下一层，
+// 但所有层级都未命中时直接返回 ErrNotFound，不再调用回调函数。写入、删除等操作只作用于第一层。
+
+// RegisterPeerTier appends a PeerPicker which load tries after the tiers registered before it.
+// 未调用 RegisterPeers 时，第一次注册的层级同时作为第一层
+func (g *Group) RegisterPeerTier(peers PeerPicker) {
+	if g.peers == nil {
+		g.peers = peers
+		return
+	}
+	g.tiers = append(g.tiers, peers)
+}
+
+// tierFlightKey 为每一层使用不同的 singleflight key，第一层（g.peers）与 peerFlightKey 相同
+func tierFlightKey(tier int, key string) string {
+	if tier == 0 {
+		return peerFlightKey(key)
+	}
+	return "peer" + strconv.Itoa(tier) + ":" + key
+}
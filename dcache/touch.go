@@ -0,0 +1,37 @@
+package dcache
+
+import "time"
+
+// Touch resets the expiry of the value cached for key to now plus its TTL, without reloading it from the getter.
+// 适合仍然有效、只需要保持热度的值，比 Refresh 更廉价。TTL 为回调函数返回的过期时间，未返回时为 stale-while-revalidate 的硬过期时间，
+// 软过期时间同样会被重置；永不过期的值只会被标记为最近访问。只作用于本节点的缓存，
+// key 未被缓存、已经过期或者是负缓存时返回 false
+func (g *Group) Touch(key string) bool {
+	if g.checkKey(key) != nil {
+		return false
+	}
+	now := time.Now()
+	return g.mainCache.touch(key, func(value ByteView) (ByteView, time.Duration, bool) {
+		if value.err != nil || value.expired(now) {
+			return value, 0, false
+		}
+		ttl := value.ttl
+		if ttl <= 0 {
+			ttl = g.hardTTL
+		}
+		if ttl <= 0 {
+			return value, 0, true
+		}
+		ttl = g.jitter(ttl)
+		if !value.softExpire.IsZero() {
+			value.softExpire = now.Add(g.softTTL)
+		}
+		value.deadline = now.Add(ttl)
+		if !value.expire.IsZero() {
+			// 开启 serveStaleOnError 时写入的值，过期时间由 Group 记录
+			value.expire = value.deadline
+			return value, 0, true
+		}
+		return value, ttl, true
+	})
+}
@@ -0,0 +1,68 @@
+package dcache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 链路追踪：Get、load、getLocally 与访问远程节点的 HTTP 请求都会创建 OpenTelemetry span，
+// trace context 通过 W3C traceparent 请求头在节点间传递，远程节点处理请求的 span 会挂在调用方的 span 下。
+// 默认使用全局的 TracerProvider（未配置时不产生任何 span），也可以通过 SetTracerProvider 单独指定。
+
+const tracerName = "DCache/dcache"
+
+// propagator 使用标准的 W3C Trace Context，不依赖全局配置的 TextMapPropagator
+var propagator = propagation.TraceContext{}
+
+// span 的属性
+var (
+	attrGroup = attribute.Key("dcache.group")
+	attrKey   = attribute.Key("dcache.key")
+	attrHit   = attribute.Key("dcache.hit")  // 是否命中本地缓存
+	attrPeer  = attribute.Key("dcache.peer") // 是否从远程节点获取
+)
+
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// SetTracerProvider sets the TracerProvider used to create spans, nil restores the global TracerProvider.
+func (g *Group) SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		g.tracer = defaultTracer()
+		return
+	}
+	g.tracer = tp.Tracer(tracerName)
+}
+
+// SetTracerProvider sets the TracerProvider used to create spans, nil restores the global TracerProvider.
+func (p *HTTPPool) SetTracerProvider(tp trace.TracerProvider) {
+	tracer := defaultTracer()
+	if tp != nil {
+		tracer = tp.Tracer(tracerName)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracer = tracer
+	p.refreshGettersLocked()
+}
+
+// endSpan 记录 err 并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startServerSpan 从请求头中提取调用方的 trace context，创建处理请求的 span
+func startServerSpan(ctx context.Context, tracer trace.Tracer, header propagation.HeaderCarrier) (context.Context, trace.Span) {
+	ctx = propagator.Extract(ctx, header)
+	return tracer.Start(ctx, "dcache.HTTPPool.ServeHTTP", trace.WithSpanKind(trace.SpanKindServer))
+}
@@ -0,0 +1,216 @@
+package twoq
+
+import (
+	"DCache/dcache/lru"
+	"container/list"
+	"time"
+)
+
+// 2Q 是一种抗扫描(scan-resistant)的淘汰策略，缓存被分为两段：
+//   - probation: 先进先出的试用队列，新的记录先进入该队列
+//   - main: LRU 队列，试用队列中的记录被再次访问后才晋升到该队列
+//
+// 全表扫描等只访问一次的 key 只会在试用队列中轮转，不会把 main 中真正的热点数据挤出缓存。
+
+// probationRatio 为试用队列最多占用 maxBytes 的比例，超出时优先淘汰试用队列中的记录
+const probationRatio = 0.25
+
+// Value 与 lru.Value 是同一个类型，使得 twoq.Cache 和 lru.Cache 可以互相替换
+type Value = lru.Value
+
+// EvictReason 与 lru.EvictReason 是同一个类型
+type EvictReason = lru.EvictReason
+
+type Cache struct {
+	maxBytes       int64                    // maxBytes is the max memory bytes the cache can use
+	nbyte          int64                    // nbytes is the memory bytes the cache is using now
+	probationBytes int64                    // 试用队列使用的内存字节数
+	ttl            time.Duration            // ttl is the default time-to-live of entries, 0 means never expire
+	probation      *list.List               // 试用队列，队首(Back)为最早进入的记录
+	main           *list.List               // 主队列，队首(Back)为最久未被访问的记录
+	cache          map[string]*list.Element // 映射 key 与两个队列中的节点
+	// 当某条记录被移除时的回调函数，reason 为记录被移除的原因
+	OnEvicted func(key string, value Value, reason EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time
+	inMain bool // 记录位于 main 还是 probation 队列中
+}
+
+// New is the Constructor of Cache
+// ttl 为记录的默认过期时间，通过 Add 添加的记录都会使用该过期时间，0 表示永不过期
+func New(maxBytes int64, ttl time.Duration, onEvicted func(key string, value Value, reason EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ttl:       ttl,
+		probation: list.New(),
+		main:      list.New(),
+		cache:     map[string]*list.Element{},
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get look ups a key's value
+// 试用队列中的记录被再次访问时晋升到 main 队列，main 队列中的记录被移动到队尾
+// 若记录已过期，则视为未命中，并将其删除（惰性过期）
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expiredNow() {
+		c.removeElement(ele, lru.EvictExpired)
+		return nil, false
+	}
+	c.touch(ele)
+	return kv.value, true
+}
+
+// Peek returns the value of key without counting as an access
+// 与 Get 不同，Peek 不会使试用队列中的记录晋升
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		if kv := ele.Value.(*entry); !kv.expiredNow() {
+			return kv.value, true
+		}
+	}
+	return
+}
+
+// Add adds a value to the cache
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL adds a value to the cache which expires after ttl
+// 新的 key 进入试用队列，已存在的 key 视为一次访问
+// ttl <= 0 表示该记录永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		delta := int64(value.Len()) - int64(kv.value.Len())
+		c.nbyte += delta
+		if !kv.inMain {
+			c.probationBytes += delta
+		}
+		kv.value = value
+		kv.expire = expire
+		c.touch(ele)
+	} else {
+		size := int64(len(key)) + int64(value.Len())
+		c.cache[key] = c.probation.PushFront(&entry{key: key, value: value, expire: expire})
+		c.nbyte += size
+		c.probationBytes += size
+	}
+	for c.maxBytes != 0 && c.nbyte > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// Remove removes the provided key from the cache
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, lru.EvictRemoved)
+	}
+}
+
+// RemoveOldest removes the oldest item
+// 试用队列超出 probationRatio 或 main 队列为空时，淘汰试用队列中最早进入的记录，否则淘汰 main 中最久未被访问的记录
+// 为了与 lru.Cache 保持相同的方法集，沿用 RemoveOldest 这个名字
+func (c *Cache) RemoveOldest() {
+	if c.probation.Len() > 0 && (c.main.Len() == 0 || c.probationBytes > int64(float64(c.maxBytes)*probationRatio)) {
+		c.removeElement(c.probation.Back(), lru.EvictCapacity)
+	} else if c.main.Len() > 0 {
+		c.removeElement(c.main.Back(), lru.EvictCapacity)
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the memory bytes the cache is using now
+func (c *Cache) Bytes() int64 {
+	return c.nbyte
+}
+
+// MaxBytes returns the max memory bytes the cache can use, 0 means unbounded
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Keys returns a copy of the keys in the cache
+// 先返回试用队列中的 key，再返回 main 队列中的 key，各自按照从旧到新的顺序
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.cache))
+	for _, ll := range []*list.List{c.probation, c.main} {
+		for ele := ll.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Clear removes all items from the cache
+// 重置两个队列和 map，并对每条被移除的记录调用 OnEvicted
+func (c *Cache) Clear() {
+	probation, main := c.probation, c.main
+	c.probation, c.main = list.New(), list.New()
+	c.cache = map[string]*list.Element{}
+	c.nbyte, c.probationBytes = 0, 0
+	if c.OnEvicted != nil {
+		for _, ll := range []*list.List{probation, main} {
+			for ele := ll.Back(); ele != nil; ele = ele.Prev() {
+				kv := ele.Value.(*entry)
+				c.OnEvicted(kv.key, kv.value, lru.EvictCleared)
+			}
+		}
+	}
+}
+
+// touch 记录一次访问：试用队列中的记录晋升到 main 队列，main 队列中的记录移动到队尾
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.inMain {
+		c.main.MoveToFront(ele)
+		return
+	}
+	c.probation.Remove(ele)
+	c.probationBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	kv.inMain = true
+	c.cache[kv.key] = c.main.PushFront(kv)
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	kv := ele.Value.(*entry)
+	size := int64(len(kv.key)) + int64(kv.value.Len())
+	if kv.inMain {
+		c.main.Remove(ele)
+	} else {
+		c.probation.Remove(ele)
+		c.probationBytes -= size
+	}
+	delete(c.cache, kv.key)
+	c.nbyte -= size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// expiredNow 与 expired 相同，但永不过期的记录不需要读取当前时间
+func (e *entry) expiredNow() bool {
+	return !e.expire.IsZero() && time.Now().After(e.expire)
+}
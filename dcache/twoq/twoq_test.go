@@ -0,0 +1,114 @@
+package twoq
+
+import (
+	"DCache/dcache/lru"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string // 定义String实现了Value接口
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), 0, nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+	if c.Bytes() != 8 {
+		t.Fatalf("expect 8 bytes, but got %d", c.Bytes())
+	}
+}
+
+func TestPromote(t *testing.T) {
+	c := New(int64(0), 0, nil)
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.Get("k1")
+
+	// k2 仍在试用队列中，k1 已晋升到 main 队列
+	if expect := []string{"k2", "k1"}; !reflect.DeepEqual(expect, c.Keys()) {
+		t.Fatalf("Keys() = %v, expect %v", c.Keys(), expect)
+	}
+	c.RemoveOldest()
+	if _, ok := c.Get("k1"); !ok || c.Len() != 1 {
+		t.Fatalf("probation entries should be evicted before main entries")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	// 每条记录占用 4 字节，缓存最多容纳 10 条记录，其中试用队列最多 2 条
+	c := New(int64(40), 0, nil)
+	hot := []string{"h0", "h1", "h2"}
+	for _, key := range hot {
+		c.Add(key, String("vv"))
+		c.Get(key)
+	}
+	// 大量只访问一次的 key 穿插着热点 key 的访问
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("%02d", i), String("vv"))
+		if i%10 == 0 {
+			c.Get(hot[i%len(hot)])
+		}
+	}
+	for _, key := range hot {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("hot key %s should survive the scan", key)
+		}
+	}
+	if c.Bytes() > 40 {
+		t.Fatalf("cache should not exceed maxBytes, got %d", c.Bytes())
+	}
+}
+
+func TestClear(t *testing.T) {
+	evicted := make([]string, 0)
+	c := New(int64(0), 0, func(key string, value Value, reason EvictReason) {
+		evicted = append(evicted, key)
+	})
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.Get("k2")
+	c.Clear()
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("cache should be empty after Clear")
+	}
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, evicted)
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	c := New(int64(12), 0, func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	c.Add("k1", String("1"))
+	c.Add("k2", String("2"))
+	c.AddWithTTL("k3", String("3"), time.Millisecond)
+	c.Add("k4", String("4"))
+	c.Add("k5", String("5")) // 超出 12 字节，淘汰 k1
+	c.Remove("k2")
+	time.Sleep(5 * time.Millisecond)
+	c.Get("k3")
+	c.Clear()
+
+	expect := map[string]EvictReason{
+		"k1": lru.EvictCapacity,
+		"k2": lru.EvictRemoved,
+		"k3": lru.EvictExpired,
+		"k4": lru.EvictCleared,
+		"k5": lru.EvictCleared,
+	}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, but got %v", expect, reasons)
+	}
+}
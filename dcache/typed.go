@@ -0,0 +1,64 @@
+package dcache
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// TypedGroup is a Group which caches values of type T.
+// 缓存中存储的仍然是 encode 编码后的字节，节点间通信的协议不变；Get 时再用 decode 解码为 T，调用方无需自己反序列化。
+// TypedGroup 内嵌了 *Group，RegisterPeers、Delete、Stats 等方法可以直接使用。
+type TypedGroup[T any] struct {
+	*Group
+	encode func(T) ([]byte, error)
+	decode func([]byte) (T, error)
+}
+
+// NewTypedGroup creates a TypedGroup, getter loads the value of type T for a key on a cache miss.
+// decode 收到的字节直接引用缓存中的数据，不能被修改，也不能在返回的 T 中持有
+func NewTypedGroup[T any](name string, cacheBytes int64, getter func(ctx context.Context, key string) (T, error),
+	encode func(T) ([]byte, error), decode func([]byte) (T, error)) *TypedGroup[T] {
+	g := NewGroup(name, cacheBytes, GetterContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		v, err := getter(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return encode(v)
+	}))
+	return &TypedGroup[T]{Group: g, encode: encode, decode: decode}
+}
+
+// NewJSONGroup creates a TypedGroup which encodes values with encoding/json.
+func NewJSONGroup[T any](name string, cacheBytes int64, getter func(ctx context.Context, key string) (T, error)) *TypedGroup[T] {
+	return NewTypedGroup(name, cacheBytes, getter,
+		func(v T) ([]byte, error) { return json.Marshal(v) },
+		func(b []byte) (T, error) {
+			var v T
+			err := json.Unmarshal(b, &v)
+			return v, err
+		})
+}
+
+// Get gets the value of key and decodes it.
+func (g *TypedGroup[T]) Get(key string) (T, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but aborts loading the value when ctx is cancelled.
+func (g *TypedGroup[T]) GetContext(ctx context.Context, key string) (T, error) {
+	view, err := g.Group.GetContext(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return g.decode(view.b)
+}
+
+// Set encodes value and sets it for key, see Group.Set.
+func (g *TypedGroup[T]) Set(key string, value T) error {
+	b, err := g.encode(value)
+	if err != nil {
+		return err
+	}
+	return g.Group.Set(key, b)
+}
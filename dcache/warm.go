@@ -0,0 +1,52 @@
+package dcache
+
+import (
+	"context"
+	"sync"
+)
+
+// 缓存预热：冷启动时缓存为空，命中率很低。Warm 通过正常的加载流程（远程节点、singleflight）并发地加载一批 key，
+// 归属于本节点的 key 会写入本地缓存，归属于远程节点的 key 则由远程节点缓存。
+
+// warmConcurrency 为预热时同时加载的 key 的个数，避免瞬间压垮数据源
+const warmConcurrency = 8
+
+// Warm loads keys into the cache, failed keys are reported in a MultiError.
+func (g *Group) Warm(keys []string) error {
+	return g.WarmContext(context.Background(), keys)
+}
+
+// WarmContext 与 Warm 相同，ctx 被取消时尚未开始加载的 key 会被跳过，并记录在 MultiError 中。
+func (g *Group) WarmContext(ctx context.Context, keys []string) error {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = make(MultiError)
+		sem    = make(chan struct{}, warmConcurrency)
+	)
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			failed[key] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, _, err := g.get(ctx, key, true); err != nil {
+				mu.Lock()
+				failed[key] = err
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
@@ -2,63 +2,242 @@ package main
 
 import (
 	"DCache/dcache"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout 为收到退出信号后等待处理中的请求完成的最长时间
+const shutdownTimeout = 5 * time.Second
+
 var db = map[string]string{
 	"Tom":  "630",
 	"Jack": "589",
 	"Sam":  "567",
 }
 
-func createNewGroup() *dcache.Group {
-	return dcache.NewGroup("scores", 2<<10, dcache.GetterFunc(
+// defaultGroups 为未指定 --groups 时创建的 group
+const defaultGroups = "scores:2048"
+
+// groupConfig 描述一个由本进程提供服务的 group
+type groupConfig struct {
+	name       string
+	cacheBytes int64
+}
+
+// parseGroups 解析 --groups 参数，格式为以逗号分隔的 name:cacheBytes，例如 scores:2048,users:4096
+func parseGroups(spec string) ([]groupConfig, error) {
+	var configs []groupConfig
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, size, ok := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid group %q, expect name:cacheBytes", item)
+		}
+		cacheBytes, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || cacheBytes <= 0 {
+			return nil, fmt.Errorf("invalid cacheBytes for group %q: %q", name, size)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate group %q", name)
+		}
+		seen[name] = true
+		configs = append(configs, groupConfig{name: name, cacheBytes: cacheBytes})
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no group in %q", spec)
+	}
+	return configs, nil
+}
+
+// createGroups 按配置创建 group，所有 group 都从同一个 db 中读取数据
+func createGroups(configs []groupConfig) []*dcache.Group {
+	groups := make([]*dcache.Group, 0, len(configs))
+	for _, c := range configs {
+		groups = append(groups, createNewGroup(c.name, c.cacheBytes))
+	}
+	return groups
+}
+
+func createNewGroup(name string, cacheBytes int64) *dcache.Group {
+	g := dcache.NewGroup(name, cacheBytes, dcache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%w: %s", dcache.ErrNotFound, key)
 		}))
+	g.SetLogger(log.Default())
+	return g
 }
 
-// startCacheServer 用来启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 gee 中，启动 HTTP 服务（共3个端口，8001/8002/8003），用户不感知。
-func startCacheServer(addr string, addrs []string, g *dcache.Group) {
+// newCachePool 创建 HTTPPool 并添加节点信息，所有 group 共用同一个 HTTPPool，
+// HTTPPool 根据请求路径中的 group 名称将请求分发到对应的 group
+func newCachePool(addr string, addrs []string, groups []*dcache.Group) *dcache.HTTPPool {
 	peers := dcache.NewHTTPPool(addr)
+	peers.SetLogger(log.Default())
 	peers.Set(addrs...)
-	g.RegisterPeers(peers)
-	log.Println("dcache is running at ", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	for _, g := range groups {
+		g.RegisterPeers(peers)
+	}
+	return peers
+}
+
+// startCacheServer 用来启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 gee 中，启动 HTTP 服务（共3个端口，8001/8002/8003），用户不感知。
+// 收到 SIGINT 或 SIGTERM 后优雅退出，等待处理中的请求完成
+func startCacheServer(addr string, addrs []string, groups []*dcache.Group) {
+	peers := newCachePool(addr, addrs, groups)
+	go func() {
+		log.Println("dcache is running at ", addr)
+		if err := peers.Start(addr[7:]); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	log.Println("dcache is shutting down at ", addr)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := peers.Shutdown(ctx); err != nil {
+		log.Println("dcache shutdown:", err)
+	}
 }
 
 // startAPIServer 用来启动一个 API 服务（端口 9999），与用户进行交互，用户感知。
-func startAPIServer(apiAddr string, g *dcache.Group) {
-	http.Handle("/api", http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			key := r.URL.Query().Get("key")
-			view, err := g.Get(key)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+func startAPIServer(apiAddr string, groups []*dcache.Group) {
+	http.Handle("/api", apiHandler(groups...))
+	log.Println("fontend server is running at", apiAddr)
+	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+}
+
+// apiResponse 是 JSON 模式下的响应格式，cached 表示是否命中了本节点的缓存
+type apiResponse struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Cached bool   `json:"cached"`
+}
+
+// apiHandler 默认返回原始字节；请求头 Accept 为 application/json 或带有 format=json 参数时，
+// 返回包含 key、value 以及值来源的 JSON。key 不存在时返回 404，其他错误返回 500。
+// 响应携带 Cache-Control 与 ETag，便于前面部署的 CDN 缓存：max-age 为值的剩余过期时间，永不过期或者未知时为 no-cache，
+// 要求 CDN 每次通过 If-None-Match 重新验证，ETag 与请求的 If-None-Match 匹配时返回 304。
+// 参数 group 指定读取的 group，未指定时读取 groups 中的第一个
+func apiHandler(groups ...*dcache.Group) http.Handler {
+	byName := make(map[string]*dcache.Group, len(groups))
+	for _, g := range groups {
+		byName[g.Name()] = g
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := groups[0]
+		if name := r.URL.Query().Get("group"); name != "" {
+			if g = byName[name]; g == nil {
+				http.Error(w, "no such group: "+name, http.StatusNotFound)
 				return
 			}
+		}
+		key := r.URL.Query().Get("key")
+		view, meta, err := g.GetWithMeta(key)
+		if errors.Is(err, dcache.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		etag := `"` + meta.Hash + `"`
+		if wantJSON(r) {
+			// JSON 与原始字节是同一个值的不同表示，ETag 需要区分开
+			etag = `"` + meta.Hash + `-json"`
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl(meta.TTL))
+		w.Header().Set("Vary", "Accept")
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if !wantJSON(r) {
 			w.Header().Set("Content-Type", "application/octet-stream")
-			_, err = w.Write(view.ByteSlice())
-		}))
-	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+			view.WriteTo(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiResponse{
+			Key:    key,
+			Value:  view.String(),
+			Source: meta.Source.String(),
+			Cached: meta.Source == dcache.SourceLocalCache,
+		})
+	})
+}
+
+// cacheControl 根据值的剩余过期时间生成 Cache-Control，ttl 为 0 表示永不过期或者未知
+func cacheControl(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "no-cache"
+	}
+	return "max-age=" + strconv.Itoa(int(ttl/time.Second))
+}
+
+// etagMatch 判断 If-None-Match 中是否包含 etag，If-None-Match 可以是 * 或者以逗号分隔的多个 ETag，弱比较时忽略 W/ 前缀
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func wantJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	accept, _, _ := mime.ParseMediaType(r.Header.Get("Accept"))
+	return accept == "application/json"
 }
 
 // main 函数需要命令行传入 port 和 api 2 个参数，用来在指定端口启动 HTTP 服务。
+// groups 参数指定本进程提供服务的 group，所有 group 注册到同一个 HTTPPool。
 func main() {
 	var port int
 	var api bool
+	var groupSpec string
 	flag.IntVar(&port, "port", 8001, "Dcache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&groupSpec, "groups", defaultGroups, "Groups to serve, as name:cacheBytes separated by commas")
 	flag.Parse()
 
+	configs, err := parseGroups(groupSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	apiAddr := "http://localhost:9999"
 	addrMap := map[int]string{
 		8001: "http://localhost:8001",
@@ -71,9 +250,9 @@ func main() {
 		addrs = append(addrs, v)
 	}
 
-	g := createNewGroup()
+	groups := createGroups(configs)
 	if api {
-		go startAPIServer(apiAddr, g)
+		go startAPIServer(apiAddr, groups)
 	}
-	startCacheServer(addrMap[port], addrs, g)
+	startCacheServer(addrMap[port], addrs, groups)
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"DCache/dcache"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIHandlerJSON(t *testing.T) {
+	h := apiHandler(createNewGroup("scores", 2<<10))
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// 第一次读取调用回调函数，默认返回原始字节
+	if w := get("/api?key=Tom", ""); w.Code != http.StatusOK || w.Body.String() != "630" {
+		t.Fatalf("expect raw value 630, but got %d %q", w.Code, w.Body.String())
+	}
+
+	// 第二次读取命中缓存
+	for _, c := range []struct{ target, accept string }{
+		{"/api?key=Tom", "application/json"},
+		{"/api?key=Tom&format=json", ""},
+	} {
+		w := get(c.target, c.accept)
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expect Content-Type application/json, but got %q", ct)
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"key": "Tom", "value": "630", "source": "local", "cached": true}
+		if len(res) != len(want) {
+			t.Fatalf("expect %v, but got %v", want, res)
+		}
+		for k, v := range want {
+			if res[k] != v {
+				t.Fatalf("expect %s to be %v, but got %v", k, v, res[k])
+			}
+		}
+	}
+}
+
+func TestAPIHandlerETag(t *testing.T) {
+	g := dcache.NewGroup("scores-etag", 2<<10, dcache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.SetStaleWhileRevalidate(time.Minute, time.Minute)
+	h := apiHandler(g)
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api?key=Tom", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "630" || etag == "" {
+		t.Fatalf("expect 630 with an ETag, but got %d %q, ETag %q", w.Code, w.Body.String(), etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "max-age=") || cc == "max-age=0" {
+		t.Fatalf("expect max-age from the TTL, but got %q", cc)
+	}
+
+	// ETag 匹配时返回 304，不携带 body
+	w = get(`"other", ` + etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatalf("expect 304 for a matching ETag, but got %d %q", w.Code, w.Body.String())
+	}
+	// ETag 不匹配时返回完整的值
+	if w = get(`"other"`); w.Code != http.StatusOK || w.Body.String() != "630" {
+		t.Fatalf("expect 200 for a stale ETag, but got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	configs, err := parseGroups("scores:2048, users:4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []groupConfig{{"scores", 2048}, {"users", 4096}}
+	if len(configs) != len(want) || configs[0] != want[0] || configs[1] != want[1] {
+		t.Fatalf("expect %v, but got %v", want, configs)
+	}
+	for _, spec := range []string{"", "scores", "scores:0", "scores:abc", "scores:1,scores:2"} {
+		if _, err := parseGroups(spec); err == nil {
+			t.Fatalf("expect an error for %q", spec)
+		}
+	}
+}
+
+func TestMultipleGroups(t *testing.T) {
+	configs, err := parseGroups("scores-multi:2048,users-multi:1024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := createGroups(configs)
+	scores, users := groups[0], groups[1]
+	peers := newCachePool("http://localhost:8001", []string{"http://localhost:8001"}, groups)
+
+	get := func(group, key string) *httptest.ResponseRecorder {
+		target := "/_dcache/" + base64.RawURLEncoding.EncodeToString([]byte(group)) +
+			"/" + base64.RawURLEncoding.EncodeToString([]byte(key))
+		w := httptest.NewRecorder()
+		peers.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// 同一个 HTTPPool 根据路径中的 group 名称将请求分发到对应的 group
+	if w := get(scores.Name(), "Tom"); w.Code != http.StatusOK {
+		t.Fatalf("expect 200 from %s, but got %d %q", scores.Name(), w.Code, w.Body.String())
+	}
+	if w := get(users.Name(), "Jack"); w.Code != http.StatusOK {
+		t.Fatalf("expect 200 from %s, but got %d %q", users.Name(), w.Code, w.Body.String())
+	}
+	if !scores.Contains("Tom") || scores.Contains("Jack") {
+		t.Fatalf("expect only Tom to be cached in %s", scores.Name())
+	}
+	if !users.Contains("Jack") || users.Contains("Tom") {
+		t.Fatalf("expect only Jack to be cached in %s", users.Name())
+	}
+	if w := get("no-such-group", "Tom"); w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 for an unknown group, but got %d", w.Code)
+	}
+
+	// API 服务通过 group 参数选择 group
+	h := apiHandler(groups...)
+	for target, code := range map[string]int{
+		"/api?key=Sam&group=" + users.Name(): http.StatusOK,
+		"/api?key=Sam&group=no-such-group":   http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != code {
+			t.Fatalf("expect %d for %s, but got %d", code, target, w.Code)
+		}
+	}
+	if !users.Contains("Sam") || scores.Contains("Sam") {
+		t.Fatalf("expect Sam to be cached only in %s", users.Name())
+	}
+}
+
+func TestAPIHandlerStatus(t *testing.T) {
+	missing := createNewGroup("scores-status", 2<<10)
+	broken := dcache.NewGroup("scores-broken", 2<<10, dcache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("db timeout")
+	}))
+	h := apiHandler(missing, broken)
+	// key 不存在返回 404，数据源失败返回 500
+	for target, code := range map[string]int{
+		"/api?key=unknown":                    http.StatusNotFound,
+		"/api?key=Tom&group=" + broken.Name(): http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != code {
+			t.Fatalf("expect %d for %s, but got %d %q", code, target, w.Code, w.Body.String())
+		}
+	}
+}